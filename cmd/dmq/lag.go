@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/indigowar/dmq/internal/group"
+	"github.com/indigowar/dmq/internal/registry"
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+// lag prints the lag of consumer groups, all groups are printed if none is given.
+//
+//	dmq lag [-data dir] [-json] [group...]
+func lag(ctx context.Context, logger *slog.Logger, args []string) error {
+	flags := flag.NewFlagSet("lag", flag.ContinueOnError)
+	data := flags.String("data", dataDir, "directory with topics")
+	asJSON := flags.Bool("json", false, "print the lag as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// the broker may be running on the directory, so nothing is changed in it.
+	topics, err := openReadOnlyRegistry(ctx, logger, *data)
+	if err != nil {
+		return err
+	}
+
+	// without the offsets topic, no group has committed an offset yet.
+	offsets, err := group.NewReadOnlyOffsets(ctx, logger, topics)
+	if err != nil && !errors.Is(err, registry.ErrTopicNotFound) {
+		return err
+	}
+
+	groups := flags.Args()
+	if len(groups) == 0 && offsets != nil {
+		groups = offsets.Groups()
+	}
+
+	responses := make([]topic.GroupLagResponse, 0, len(groups))
+	for _, name := range groups {
+		response := topic.GroupLagResponse{Group: name, Partitions: []topic.PartitionLag{}}
+		if offsets != nil {
+			if response, err = offsets.Lag(ctx, topic.GroupLagRequest{Group: name}); err != nil {
+				return err
+			}
+		}
+
+		responses = append(responses, response)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(responses)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "GROUP\tTOPIC\tPARTITION\tCOMMITTED\tHIGH-WATERMARK\tLAG\tTIME-LAG")
+	for _, response := range responses {
+		for _, p := range response.Partitions {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n", response.Group, p.Topic, p.Partition, p.Committed, p.HighWatermark, p.Lag, p.TimeLag)
+		}
+	}
+
+	return writer.Flush()
+}
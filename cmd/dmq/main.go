@@ -2,33 +2,101 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"time"
 
-	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/core/communication"
+	"github.com/indigowar/dmq/internal/partition/files"
+	"github.com/indigowar/dmq/internal/partition/index"
 	"github.com/indigowar/dmq/internal/partition/log"
+	"github.com/indigowar/dmq/internal/registry"
+	"github.com/indigowar/dmq/internal/topic"
 )
 
+// dataDir is the default directory, where topics are stored.
+const dataDir = "/tmp/dmq"
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	l := log.InitLog(ctx, 4)
-
-	file, pos, err := l.WriteNew(context.Background(), "/tmp/dmq", "log", record.Record{
-		Offset:    0,
-		Timestamp: time.Now(),
-		Key:       []byte{},
-		Value:     []byte("Hello, world, how are you"),
-	})
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "lag" {
+		err = lag(ctx, slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})), os.Args[2:])
+	} else {
+		err = hello(ctx, slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	}
 
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+}
+
+// hello writes a record into the "hello" topic.
+func hello(ctx context.Context, logger *slog.Logger) error {
+	topics, err := openRegistry(ctx, logger, dataDir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := topics.Create(ctx, "hello", registry.Config{Partitions: 1}); err != nil && !errors.Is(err, registry.ErrTopicAlreadyExists) {
+		return err
+	}
+
+	partitions, err := topics.Partitions("hello")
+	if err != nil {
+		return err
+	}
+
+	response, err := partitions.Write(ctx, topic.WriteIntoPartitionRequest{
+		Partition: 0,
+		Value:     []byte("Hello, world, how are you"),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("offset: %d, timestamp: %s", response.Offset, response.Timestamp)
+
+	return nil
+}
+
+func openRegistry(ctx context.Context, logger *slog.Logger, path string) (*registry.Registry, error) {
+	return initRegistry(ctx, logger, path, registry.NewRegistry)
+}
+
+// openReadOnlyRegistry opens topics to inspect them, files in the path are not changed.
+func openReadOnlyRegistry(ctx context.Context, logger *slog.Logger, path string) (*registry.Registry, error) {
+	return initRegistry(ctx, logger, path, registry.NewReadOnlyRegistry)
+}
+
+type registryConstructor func(*slog.Logger, string, index.Index, log.Log, *files.Cache) (*registry.Registry, error)
+
+func initRegistry(ctx context.Context, logger *slog.Logger, path string, open registryConstructor) (*registry.Registry, error) {
+	pool := communication.PoolConfig{
+		Min:         1,
+		Max:         4,
+		GrowAfter:   10 * time.Millisecond,
+		IdleTimeout: 30 * time.Second,
+	}
+
+	cache := files.NewCache(64)
+	go func() {
+		<-ctx.Done()
+		cache.Close()
+	}()
 
-	fmt.Printf("file: %d, pos: %d", file, pos)
+	return open(
+		logger,
+		path,
+		index.InitIndex(ctx, pool, cache),
+		log.InitLog(ctx, pool, cache, log.DefaultMaxEntrySize),
+		cache,
+	)
 }
 
 // var (
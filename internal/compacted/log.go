@@ -0,0 +1,199 @@
+package compacted
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/indigowar/dmq/internal/partition"
+	"github.com/indigowar/dmq/internal/registry"
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+// logSize keeps logs of the topic small, so they are compacted often.
+const logSize = 4096
+
+// compactEvery is the amount of writes between compactions of the topic.
+const compactEvery = 4096
+
+var (
+	ErrReadOnly = errors.New("compacted topic is opened read-only")
+)
+
+// scanChunk is the maximum amount of records, which are read at once by a scan.
+const scanChunk = 1024
+
+// Log is a key-value store on top of an internal topic, which is compacted,
+// so it keeps only the latest value of every key.
+type Log struct {
+	logger *slog.Logger
+
+	mutex  sync.Mutex
+	writes int64
+	// compact wakes the compaction, so writers do not wait for it.
+	compact chan struct{}
+	// readOnly log is not written into and not compacted.
+	readOnly bool
+
+	name       string
+	partitions *partition.Manager
+}
+
+// Put writes the value of the key, nil value deletes the key.
+func (l *Log) Put(ctx context.Context, key []byte, value []byte) error {
+	_, err := l.Write(ctx, topic.WriteIntoPartitionRequest{Key: key, Value: value})
+	return err
+}
+
+// Write writes the record and returns its offset, the Timestamp is used if the topic has record.CreateTime.
+// A record, which has expired, is removed by a compaction together with older values of its key.
+func (l *Log) Write(ctx context.Context, request topic.WriteIntoPartitionRequest) (int64, error) {
+	if l.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	request.Partition = 0
+	response, err := l.partitions.Write(ctx, request)
+	if err != nil {
+		l.logger.Error("failed to write into a compacted topic", "topic", l.name, "err", err)
+		return 0, err
+	}
+
+	l.writes++
+	if l.writes%compactEvery == 0 {
+		select {
+		case l.compact <- struct{}{}:
+		default:
+		}
+	}
+
+	return response.Offset, nil
+}
+
+// Read returns the record at the offset, which is returned by the Write or passed to the Scan.
+func (l *Log) Read(ctx context.Context, offset int64) (topic.ReadFromPartitionResponse, error) {
+	return l.partitions.ReadByOffset(ctx, topic.ReadByOffsetFromPartitionRequest{Offset: offset})
+}
+
+// run compacts the topic in the background, when enough writes are done, until the ctx is done.
+func (l *Log) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.compact:
+		}
+
+		if _, err := l.partitions.Compact(ctx, topic.CompactPartitionRequest{}); err != nil {
+			l.logger.Warn("failed to compact a topic", "topic", l.name, "err", err)
+		}
+	}
+}
+
+// Load calls the apply for every stored key in the order of writes,
+// value of a deleted key is empty, an expired value deletes the key as well.
+func (l *Log) Load(ctx context.Context, apply func(key []byte, value []byte) error) error {
+	now := time.Now()
+
+	return l.Scan(ctx, func(r topic.ReadFromPartitionResponse) error {
+		if !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt) {
+			return apply(r.Key, nil)
+		}
+
+		return apply(r.Key, r.Value)
+	})
+}
+
+// Scan calls the apply for every stored record in the order of writes, expired records are passed as well:
+// an expired value is kept, until a compaction removes it with older values of the key.
+// Records are read in chunks, so the topic is not read into memory at once.
+func (l *Log) Scan(ctx context.Context, apply func(r topic.ReadFromPartitionResponse) error) error {
+	watermark, err := l.partitions.HighWatermark(ctx, topic.HighWatermarkRequest{})
+	if err != nil {
+		return err
+	}
+
+	first, err := l.partitions.LowWatermark(ctx, topic.LowWatermarkRequest{})
+	if err != nil {
+		return err
+	}
+
+	for offset := first.Offset; offset < watermark.NextOffset; {
+		response, err := l.partitions.ReadRange(ctx, topic.ReadRangeFromPartitionRequest{
+			Offset: offset,
+			Count:  min(watermark.NextOffset-offset, scanChunk),
+
+			IncludeExpired: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, r := range response.Records {
+			if err := apply(r); err != nil {
+				return err
+			}
+		}
+
+		if response.NextOffset <= offset {
+			break
+		}
+		offset = response.NextOffset
+	}
+
+	return nil
+}
+
+// Open opens the compacted topic, it is created, if it does not exist.
+// The topic is compacted in the background until the ctx is done.
+func Open(ctx context.Context, logger *slog.Logger, topics *registry.Registry, name string) (*Log, error) {
+	return OpenWithConfig(ctx, logger, topics, name, partition.Config{})
+}
+
+// OpenReadOnly opens the existing compacted topic for reads, it is neither created nor compacted.
+func OpenReadOnly(logger *slog.Logger, topics *registry.Registry, name string) (*Log, error) {
+	partitions, err := topics.Partitions(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Log{
+		logger:     logger,
+		readOnly:   true,
+		name:       name,
+		partitions: partitions,
+	}, nil
+}
+
+// OpenWithConfig opens the compacted topic, it is created with the config, if it does not exist.
+// The topic is compacted in the background until the ctx is done.
+func OpenWithConfig(ctx context.Context, logger *slog.Logger, topics *registry.Registry, name string, config partition.Config) (*Log, error) {
+	if config.LogSize == 0 {
+		config.LogSize = logSize
+	}
+
+	if _, err := topics.CreateInternal(ctx, name, registry.Config{Partitions: 1, Partition: config}); err != nil && !errors.Is(err, registry.ErrTopicAlreadyExists) {
+		return nil, err
+	}
+
+	partitions, err := topics.Partitions(name)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{
+		logger:     logger,
+		compact:    make(chan struct{}, 1),
+		name:       name,
+		partitions: partitions,
+	}
+
+	go l.run(ctx)
+
+	return l, nil
+}
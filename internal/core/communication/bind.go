@@ -0,0 +1,17 @@
+package communication
+
+import "context"
+
+// Bind binds a dependency to the action, so it can be executed by workers.
+func Bind[D any, In any, Out any](dependency D, action func(context.Context, D, In) (Out, error)) func(context.Context, In) (Out, error) {
+	return func(ctx context.Context, input In) (Out, error) {
+		return action(ctx, dependency, input)
+	}
+}
+
+// BindStream binds a dependency to the streaming action, so it can be executed by workers.
+func BindStream[D any, In any, Out any](dependency D, action func(context.Context, D, In, Emitter[Out]) error) StreamAction[In, Out] {
+	return func(ctx context.Context, input In, emitter Emitter[Out]) error {
+		return action(ctx, dependency, input, emitter)
+	}
+}
@@ -0,0 +1,237 @@
+package communication
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrHubIsClosed = errors.New("hub is closed")
+)
+
+// SlowConsumerPolicy defines what a Hub does, when a subscriber's buffer is full.
+type SlowConsumerPolicy int
+
+const (
+	// Block waits until the subscriber has a free place in the buffer.
+	Block SlowConsumerPolicy = iota
+	// DropOldest removes the oldest value in the buffer to make place for a new one.
+	DropOldest
+	// DropNewest skips the value for the subscriber.
+	DropNewest
+	// Disconnect unsubscribes the subscriber.
+	Disconnect
+)
+
+// Hub broadcasts published values to every subscriber.
+// Subscribers can join and leave at any time, each has its own buffer and SlowConsumerPolicy.
+//
+// The zero value is an empty hub ready to use.
+type Hub[T any] struct {
+	mutex       sync.RWMutex
+	subscribers map[*Subscription[T]]struct{}
+	closed      bool
+}
+
+// Subscription is a subscriber of a Hub.
+type Subscription[T any] struct {
+	hub    *Hub[T]
+	policy SlowConsumerPolicy
+
+	// sendMutex serializes sends from concurrent publishers, required for DropOldest.
+	sendMutex sync.Mutex
+
+	values chan T
+	done   chan struct{}
+	once   sync.Once
+}
+
+// C returns the channel of values for the subscriber.
+// The channel is closed after the subscriber is unsubscribed or the hub is closed.
+func (s *Subscription[T]) C() <-chan T {
+	return s.values
+}
+
+// Unsubscribe removes the subscriber from the hub.
+func (s *Subscription[T]) Unsubscribe() {
+	s.hub.remove(s)
+}
+
+func (s *Subscription[T]) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// send delivers the value according to the policy,
+// it returns false when the subscriber has to be disconnected.
+func (s *Subscription[T]) send(ctx context.Context, value T) bool {
+	s.sendMutex.Lock()
+	defer s.sendMutex.Unlock()
+
+	select {
+	case <-s.done:
+		return true
+	case s.values <- value:
+		return true
+	default:
+	}
+
+	switch s.policy {
+	case DropOldest:
+		select {
+		case <-s.values:
+		default:
+		}
+
+		select {
+		case s.values <- value:
+		default:
+		}
+	case DropNewest:
+	case Disconnect:
+		s.stop()
+		return false
+	default:
+		select {
+		case <-ctx.Done():
+		case <-s.done:
+		case s.values <- value:
+		}
+	}
+
+	return true
+}
+
+// Subscribe adds a new subscriber with the given buffer size and policy.
+// Drop policies need a place for a value, so their buffer is at least 1.
+func (h *Hub[T]) Subscribe(buffer int, policy SlowConsumerPolicy) (*Subscription[T], error) {
+	buffer = max(buffer, 0)
+	if policy == DropOldest || policy == DropNewest {
+		buffer = max(buffer, 1)
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return nil, ErrHubIsClosed
+	}
+
+	if h.subscribers == nil {
+		h.subscribers = make(map[*Subscription[T]]struct{})
+	}
+
+	s := &Subscription[T]{
+		hub:    h,
+		policy: policy,
+		values: make(chan T, buffer),
+		done:   make(chan struct{}),
+	}
+
+	h.subscribers[s] = struct{}{}
+
+	return s, nil
+}
+
+// Publish sends the value to all subscribers.
+// With the Block policy it waits for slow subscribers, until ctx is done.
+func (h *Hub[T]) Publish(ctx context.Context, value T) error {
+	h.mutex.RLock()
+
+	if h.closed {
+		h.mutex.RUnlock()
+		return ErrHubIsClosed
+	}
+
+	var disconnected []*Subscription[T]
+	for s := range h.subscribers {
+		if !s.send(ctx, value) {
+			disconnected = append(disconnected, s)
+		}
+	}
+
+	h.mutex.RUnlock()
+
+	for _, s := range disconnected {
+		h.remove(s)
+	}
+
+	if ctx.Err() != nil {
+		return ErrOperationIsCancelled
+	}
+
+	return nil
+}
+
+// Run publishes every value from the source until ctx is done or the source is closed.
+func (h *Hub[T]) Run(ctx context.Context, source <-chan T) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v, ok := <-source:
+			if !ok {
+				return
+			}
+
+			if err := h.Publish(ctx, v); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the amount of subscribers.
+func (h *Hub[T]) Len() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return len(h.subscribers)
+}
+
+// Close unsubscribes everyone, further Subscribe and Publish calls fail.
+func (h *Hub[T]) Close() {
+	for _, s := range h.snapshot() {
+		s.stop()
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+
+	for s := range h.subscribers {
+		close(s.values)
+	}
+	h.subscribers = nil
+}
+
+func (h *Hub[T]) snapshot() []*Subscription[T] {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	subscribers := make([]*Subscription[T], 0, len(h.subscribers))
+	for s := range h.subscribers {
+		subscribers = append(subscribers, s)
+	}
+
+	return subscribers
+}
+
+func (h *Hub[T]) remove(s *Subscription[T]) {
+	// stop first, so a publisher blocked on this subscriber releases the lock.
+	s.stop()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.subscribers[s]; !ok {
+		return
+	}
+
+	delete(h.subscribers, s)
+	close(s.values)
+}
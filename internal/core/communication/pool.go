@@ -0,0 +1,174 @@
+package communication
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// PoolConfig describes the bounds and the resize policy of a Pool.
+type PoolConfig struct {
+	// Min is the amount of workers that is always kept alive.
+	Min int `json:"min"`
+	// Max is the upper bound for the amount of workers.
+	Max int `json:"max"`
+	// GrowAfter is the time a request may wait in the queue,
+	// before the pool starts a new worker for it.
+	GrowAfter time.Duration `json:"grow_after"`
+	// IdleTimeout is the time a worker may stay without work,
+	// before it is stopped. Zero disables shrinking.
+	IdleTimeout time.Duration `json:"idle_timeout"`
+}
+
+// Pool is a set of workers, that execute the same action.
+// The amount of workers is kept between PoolConfig.Min and PoolConfig.Max:
+// it grows when requests wait for too long and shrinks when workers are idle.
+type Pool[In any, Out any] struct {
+	config PoolConfig
+	action func(context.Context, In) (Out, error)
+
+	requests chan Request[In, Out]
+	work     chan Request[In, Out]
+
+	size atomic.Int64
+}
+
+// Requests returns the channel, that accepts requests for the pool.
+func (p *Pool[In, Out]) Requests() chan<- Request[In, Out] {
+	return p.requests
+}
+
+// Size returns the current amount of workers.
+func (p *Pool[In, Out]) Size() int {
+	return int(p.size.Load())
+}
+
+func (p *Pool[In, Out]) dispatch(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case request := <-p.requests:
+			p.enqueue(ctx, request)
+		}
+	}
+}
+
+func (p *Pool[In, Out]) enqueue(ctx context.Context, request Request[In, Out]) {
+	select {
+	case p.work <- request:
+		return
+	default:
+	}
+
+	if p.config.GrowAfter <= 0 || p.config.Min == p.config.Max {
+		select {
+		case <-ctx.Done():
+		case p.work <- request:
+		}
+		return
+	}
+
+	timer := time.NewTimer(p.config.GrowAfter)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p.work <- request:
+			return
+		case <-timer.C:
+			p.grow(ctx)
+			timer.Reset(p.config.GrowAfter)
+		}
+	}
+}
+
+func (p *Pool[In, Out]) grow(ctx context.Context) {
+	for {
+		size := p.size.Load()
+		if size >= int64(p.config.Max) {
+			return
+		}
+
+		if p.size.CompareAndSwap(size, size+1) {
+			go p.worker(ctx)
+			return
+		}
+	}
+}
+
+func (p *Pool[In, Out]) shrink() bool {
+	for {
+		size := p.size.Load()
+		if size <= int64(p.config.Min) {
+			return false
+		}
+
+		if p.size.CompareAndSwap(size, size-1) {
+			return true
+		}
+	}
+}
+
+func (p *Pool[In, Out]) worker(ctx context.Context) {
+	var (
+		timer *time.Timer
+		idle  <-chan time.Time
+	)
+
+	if p.config.IdleTimeout > 0 {
+		timer = time.NewTimer(p.config.IdleTimeout)
+		defer timer.Stop()
+
+		idle = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.size.Add(-1)
+			return
+		case request := <-p.work:
+			handle(ctx, p.action, request)
+
+			if timer != nil && !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-idle:
+			if p.shrink() {
+				return
+			}
+		}
+
+		if timer != nil {
+			timer.Reset(p.config.IdleTimeout)
+		}
+	}
+}
+
+// NewPool starts a pool of workers for the action, with PoolConfig.Min workers running.
+func NewPool[In any, Out any](ctx context.Context, action func(context.Context, In) (Out, error), config PoolConfig) *Pool[In, Out] {
+	config.Min = max(config.Min, 1)
+	config.Max = max(config.Max, config.Min)
+
+	p := &Pool[In, Out]{
+		config:   config,
+		action:   action,
+		requests: make(chan Request[In, Out]),
+		work:     make(chan Request[In, Out]),
+	}
+
+	p.size.Store(int64(config.Min))
+	for i := 0; i != config.Min; i++ {
+		go p.worker(ctx)
+	}
+
+	go p.dispatch(ctx)
+
+	return p
+}
@@ -0,0 +1,152 @@
+package communication
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrStreamIsClosed = errors.New("stream is closed by consumer")
+)
+
+// StreamAction is an action, that emits many values for a single input.
+// Returned error terminates the stream, nil means the stream is completed.
+type StreamAction[In any, Out any] func(context.Context, In, Emitter[Out]) error
+
+// Emitter sends values of a stream to its consumer.
+type Emitter[Out any] struct {
+	values chan<- Out
+	done   <-chan struct{}
+}
+
+// Emit waits until the consumer has a place for the value.
+// It fails, when the consumer has closed the stream or ctx is done.
+func (e Emitter[Out]) Emit(ctx context.Context, value Out) error {
+	select {
+	case <-ctx.Done():
+		return ErrOperationIsCancelled
+	case <-e.done:
+		return ErrStreamIsClosed
+	case e.values <- value:
+		return nil
+	}
+}
+
+type streamInput[In any, Out any] struct {
+	input   In
+	values  chan Out
+	emitter Emitter[Out]
+}
+
+// StreamPool is a Pool of workers, that execute a StreamAction.
+type StreamPool[In any, Out any] struct {
+	pool *Pool[streamInput[In, Out], struct{}]
+}
+
+// Open queues the input and returns a stream of its values.
+// buffer is the amount of values, that the action can emit ahead of the consumer.
+func (p *StreamPool[In, Out]) Open(ctx context.Context, input In, buffer int) *Stream[Out] {
+	values := make(chan Out, max(buffer, 0))
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+
+	stream := &Stream[Out]{
+		values: values,
+		errs:   errs,
+		done:   done,
+	}
+
+	request := Request[streamInput[In, Out], struct{}]{
+		Input: streamInput[In, Out]{
+			input:   input,
+			values:  values,
+			emitter: Emitter[Out]{values: values, done: done},
+		},
+		Output: make(chan struct{}, 1),
+		Error:  errs,
+	}
+
+	select {
+	case <-ctx.Done():
+		stream.err = ErrOperationIsCancelled
+		stream.finished = true
+		stream.Close()
+	case p.pool.Requests() <- request:
+	}
+
+	return stream
+}
+
+// Size returns the current amount of workers.
+func (p *StreamPool[In, Out]) Size() int {
+	return p.pool.Size()
+}
+
+// NewStreamPool starts a pool of workers for the streaming action.
+func NewStreamPool[In any, Out any](ctx context.Context, action StreamAction[In, Out], config PoolConfig) *StreamPool[In, Out] {
+	run := func(ctx context.Context, input streamInput[In, Out]) (struct{}, error) {
+		defer close(input.values)
+		return struct{}{}, action(ctx, input.input, input.emitter)
+	}
+
+	return &StreamPool[In, Out]{
+		pool: NewPool(ctx, run, config),
+	}
+}
+
+// Stream is the consumer side of a streaming request.
+type Stream[Out any] struct {
+	values <-chan Out
+	errs   <-chan error
+
+	done chan struct{}
+	once sync.Once
+
+	finished bool
+	err      error
+}
+
+// Next waits for the next value.
+// It returns false, when the stream is over, Err tells the reason.
+func (s *Stream[Out]) Next(ctx context.Context) (Out, bool) {
+	var empty Out
+
+	if s.finished {
+		return empty, false
+	}
+
+	select {
+	case <-s.done:
+		s.finished = true
+		s.err = ErrStreamIsClosed
+		return empty, false
+	default:
+	}
+
+	select {
+	case <-ctx.Done():
+		s.finished = true
+		s.err = ErrOperationIsCancelled
+		s.Close()
+		return empty, false
+	case v, ok := <-s.values:
+		if ok {
+			return v, true
+		}
+
+		s.finished = true
+		s.err = <-s.errs
+		return empty, false
+	}
+}
+
+// Err returns the terminal error of the stream, nil if it has been completed.
+func (s *Stream[Out]) Err() error {
+	return s.err
+}
+
+// Close cancels the stream, the action stops on its next Emit.
+func (s *Stream[Out]) Close() {
+	s.once.Do(func() { close(s.done) })
+}
@@ -13,15 +13,7 @@ func Worker[In any, Out any](ctx context.Context, action func(context.Context, I
 			case <-ctx.Done():
 				return
 			case request := <-requestChannel:
-				output, err := action(ctx, request.Input)
-				if err != nil {
-					request.Error <- err
-				} else {
-					request.Output <- output
-				}
-
-				close(request.Output)
-				close(request.Error)
+				handle(ctx, action, request)
 			}
 		}
 	}()
@@ -29,29 +21,20 @@ func Worker[In any, Out any](ctx context.Context, action func(context.Context, I
 	return requestChannel
 }
 
+// Workers starts a pool with a fixed number of workers.
+// Use NewPool for a pool which adapts its size to the load.
 func Workers[In any, Out any](ctx context.Context, action func(context.Context, In) (Out, error), count int) chan Request[In, Out] {
-	requestChannel := make(chan Request[In, Out])
-
-	for i := 0; i != count; i++ {
-		go func() {
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case request := <-requestChannel:
-					output, err := action(ctx, request.Input)
-					if err != nil {
-						request.Error <- err
-					} else {
-						request.Output <- output
-					}
+	return NewPool(ctx, action, PoolConfig{Min: count, Max: count}).requests
+}
 
-					close(request.Output)
-					close(request.Error)
-				}
-			}
-		}()
+func handle[In any, Out any](ctx context.Context, action func(context.Context, In) (Out, error), request Request[In, Out]) {
+	output, err := action(ctx, request.Input)
+	if err != nil {
+		request.Error <- err
+	} else {
+		request.Output <- output
 	}
 
-	return requestChannel
+	close(request.Output)
+	close(request.Error)
 }
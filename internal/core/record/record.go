@@ -7,9 +7,37 @@ type Record struct {
 	Timestamp time.Time `json:"timestamp"`
 	Key       []byte    `json:"key,omitempty"`
 	Value     []byte    `json:"value"`
+	Headers   []Header  `json:"headers,omitempty"`
+	// ExpiresAt is the time, after which the record is not delivered, zero value means never.
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
-type RecordCreationPayload struct {
-	Key   []byte `json:"key,omitempty"`
+// Expired reports, whether the record has expired by the time.
+func (r Record) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// Header is a key/value pair attached to a record, headers keep the order they were written in.
+type Header struct {
+	Key   string `json:"key"`
 	Value []byte `json:"value"`
 }
+
+type RecordCreationPayload struct {
+	Key     []byte   `json:"key,omitempty"`
+	Value   []byte   `json:"value"`
+	Headers []Header `json:"headers,omitempty"`
+	// Timestamp is used with CreateTime, zero value means the time of the write.
+	Timestamp time.Time `json:"timestamp"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TimestampType defines, which timestamp is stored in a record.
+type TimestampType string
+
+const (
+	// LogAppendTime is the time, when the record is written into a partition.
+	LogAppendTime TimestampType = "log_append_time"
+	// CreateTime is the time, provided by the producer.
+	CreateTime TimestampType = "create_time"
+)
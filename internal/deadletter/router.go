@@ -0,0 +1,128 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/registry"
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+// Headers, which describe the origin of a moved record.
+const (
+	HeaderOriginalTopic     = "dmq-original-topic"
+	HeaderOriginalPartition = "dmq-original-partition"
+	HeaderOriginalOffset    = "dmq-original-offset"
+	HeaderFailureReason     = "dmq-failure-reason"
+	HeaderAttempts          = "dmq-attempts"
+	// HeaderRetries is the amount of retry topics, the record has passed.
+	HeaderRetries = "dmq-retries"
+)
+
+const headerPrefix = "dmq-"
+
+var (
+	ErrNoDeadLetterTopic = errors.New("topic has no dead letter topic")
+)
+
+// Failure is a record, which a consumer has failed to process.
+type Failure struct {
+	Topic     string
+	Partition int64
+	Record    topic.ReadFromPartitionResponse
+	Reason    string
+	// Attempts is the amount of attempts to process the record in the topic.
+	Attempts int64
+}
+
+// Router moves failed records into retry topics of their original topic and then into its dead letter topic.
+type Router struct {
+	logger *slog.Logger
+	topics *registry.Registry
+}
+
+// Forward writes the failed record into the next topic of the chain, it returns the name of the topic.
+func (r *Router) Forward(ctx context.Context, failure Failure) (string, error) {
+	origin, retries, attempts := r.origin(failure)
+
+	config, err := r.topics.Config(origin.Topic)
+	if err != nil {
+		return "", err
+	}
+
+	destination := config.DeadLetter.Topic
+	if retries < int64(len(config.DeadLetter.RetryTopics)) {
+		destination = config.DeadLetter.RetryTopics[retries]
+		retries++
+	}
+
+	if destination == "" {
+		return "", ErrNoDeadLetterTopic
+	}
+
+	headers := make([]record.Header, 0, len(failure.Record.Headers)+6)
+	for _, h := range failure.Record.Headers {
+		if !strings.HasPrefix(h.Key, headerPrefix) {
+			headers = append(headers, h)
+		}
+	}
+
+	headers = append(headers,
+		record.Header{Key: HeaderOriginalTopic, Value: []byte(origin.Topic)},
+		record.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.FormatInt(origin.Partition, 10))},
+		record.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(origin.Record.Offset, 10))},
+		record.Header{Key: HeaderFailureReason, Value: []byte(failure.Reason)},
+		record.Header{Key: HeaderAttempts, Value: []byte(strconv.FormatInt(attempts, 10))},
+		record.Header{Key: HeaderRetries, Value: []byte(strconv.FormatInt(retries, 10))},
+	)
+
+	if _, err := r.topics.Write(ctx, topic.WriteIntoTopicRequest{
+		Topic:     destination,
+		Key:       failure.Record.Key,
+		Value:     failure.Record.Value,
+		Headers:   headers,
+		ExpiresAt: failure.Record.ExpiresAt,
+	}); err != nil {
+		r.logger.Error("failed to move a record", "topic", failure.Topic, "offset", failure.Record.Offset, "destination", destination, "err", err)
+		return "", err
+	}
+
+	r.logger.Info("moved a failed record", "topic", failure.Topic, "offset", failure.Record.Offset, "destination", destination, "reason", failure.Reason)
+
+	return destination, nil
+}
+
+// origin returns the failure in the original topic, the amount of passed retry topics and the total amount of attempts.
+func (r *Router) origin(failure Failure) (Failure, int64, int64) {
+	headers := make(map[string]string)
+	for _, h := range failure.Record.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	name, ok := headers[HeaderOriginalTopic]
+	if !ok {
+		return failure, 0, failure.Attempts
+	}
+
+	partition, err1 := strconv.ParseInt(headers[HeaderOriginalPartition], 10, 64)
+	offset, err2 := strconv.ParseInt(headers[HeaderOriginalOffset], 10, 64)
+	retries, err3 := strconv.ParseInt(headers[HeaderRetries], 10, 64)
+	attempts, err4 := strconv.ParseInt(headers[HeaderAttempts], 10, 64)
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		r.logger.Warn("a record has invalid origin headers", "topic", failure.Topic, "offset", failure.Record.Offset, "err", err)
+		return failure, 0, failure.Attempts
+	}
+
+	origin := failure
+	origin.Topic, origin.Partition, origin.Record.Offset = name, partition, offset
+
+	return origin, retries, attempts + failure.Attempts
+}
+
+func NewRouter(logger *slog.Logger, topics *registry.Registry) *Router {
+	return &Router{logger: logger, topics: topics}
+}
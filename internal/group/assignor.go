@@ -0,0 +1,189 @@
+package group
+
+import (
+	"slices"
+)
+
+// Assignment maps topics to partitions, which are assigned to a member.
+type Assignment map[string][]int64
+
+// Member is a member of a group with topics, it is subscribed to.
+type Member struct {
+	ID     string
+	Topics []string
+}
+
+// Assignor divides partitions of topics between members of a group.
+// Members are sorted by ID, partitions maps topics to the amount of their partitions,
+// previous is the assignment of the previous generation.
+type Assignor interface {
+	Assign(members []Member, partitions map[string]int64, previous map[string]Assignment) map[string]Assignment
+}
+
+const (
+	RangeAssignor      = "range"
+	RoundRobinAssignor = "round_robin"
+	StickyAssignor     = "sticky"
+)
+
+// rangeAssignor gives every member a continuous range of partitions of each topic.
+type rangeAssignor struct{}
+
+func (rangeAssignor) Assign(members []Member, partitions map[string]int64, previous map[string]Assignment) map[string]Assignment {
+	assignments := emptyAssignments(members)
+
+	for _, name := range sortedKeys(partitions) {
+		subscribed := subscribers(members, name)
+		if len(subscribed) == 0 {
+			continue
+		}
+
+		count := partitions[name]
+		size, extra := count/int64(len(subscribed)), count%int64(len(subscribed))
+
+		next := int64(0)
+		for i, member := range subscribed {
+			n := size
+			if int64(i) < extra {
+				n++
+			}
+
+			for p := next; p != next+n; p++ {
+				assignments[member].add(name, p)
+			}
+			next += n
+		}
+	}
+
+	return assignments
+}
+
+// roundRobinAssignor deals partitions of all topics to members one by one.
+type roundRobinAssignor struct{}
+
+func (roundRobinAssignor) Assign(members []Member, partitions map[string]int64, previous map[string]Assignment) map[string]Assignment {
+	assignments := emptyAssignments(members)
+
+	next := 0
+	for _, name := range sortedKeys(partitions) {
+		for p := int64(0); p != partitions[name]; p++ {
+			// the next member, which is subscribed to the topic.
+			for i := 0; i != len(members); i++ {
+				member := members[(next+i)%len(members)]
+				if slices.Contains(member.Topics, name) {
+					assignments[member.ID].add(name, p)
+					next = (next + i + 1) % len(members)
+					break
+				}
+			}
+		}
+	}
+
+	return assignments
+}
+
+// stickyAssignor keeps partitions of the previous generation with their members,
+// while the partitions stay balanced, and gives the rest to the least loaded members.
+type stickyAssignor struct{}
+
+func (stickyAssignor) Assign(members []Member, partitions map[string]int64, previous map[string]Assignment) map[string]Assignment {
+	assignments := emptyAssignments(members)
+
+	total := int64(0)
+	for _, name := range sortedKeys(partitions) {
+		if len(subscribers(members, name)) != 0 {
+			total += partitions[name]
+		}
+	}
+
+	quota := 0
+	if len(members) != 0 {
+		quota = int((total + int64(len(members)) - 1) / int64(len(members)))
+	}
+
+	taken := make(map[string]map[int64]bool)
+	for _, member := range members {
+		for _, name := range sortedKeys(previous[member.ID]) {
+			if !slices.Contains(member.Topics, name) {
+				continue
+			}
+
+			for _, p := range previous[member.ID][name] {
+				if p >= partitions[name] || taken[name][p] || assignments[member.ID].size() >= quota {
+					continue
+				}
+
+				if taken[name] == nil {
+					taken[name] = make(map[int64]bool)
+				}
+				taken[name][p] = true
+				assignments[member.ID].add(name, p)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(partitions) {
+		subscribed := subscribers(members, name)
+
+		for p := int64(0); p != partitions[name] && len(subscribed) != 0; p++ {
+			if taken[name][p] {
+				continue
+			}
+
+			least := subscribed[0]
+			for _, member := range subscribed[1:] {
+				if assignments[member].size() < assignments[least].size() {
+					least = member
+				}
+			}
+
+			assignments[least].add(name, p)
+		}
+	}
+
+	return assignments
+}
+
+func (a Assignment) add(topic string, partition int64) {
+	a[topic] = append(a[topic], partition)
+}
+
+func (a Assignment) size() int {
+	size := 0
+	for _, partitions := range a {
+		size += len(partitions)
+	}
+
+	return size
+}
+
+func emptyAssignments(members []Member) map[string]Assignment {
+	assignments := make(map[string]Assignment, len(members))
+	for _, member := range members {
+		assignments[member.ID] = make(Assignment)
+	}
+
+	return assignments
+}
+
+// subscribers returns IDs of members, which are subscribed to the topic.
+func subscribers(members []Member, topic string) []string {
+	var ids []string
+	for _, member := range members {
+		if slices.Contains(member.Topics, topic) {
+			ids = append(ids, member.ID)
+		}
+	}
+
+	return ids
+}
+
+func sortedKeys[T any](topics map[string]T) []string {
+	names := make([]string, 0, len(topics))
+	for name := range topics {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
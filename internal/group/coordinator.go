@@ -0,0 +1,471 @@
+package group
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/indigowar/dmq/internal/deadletter"
+	"github.com/indigowar/dmq/internal/registry"
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+var (
+	ErrUnknownMember        = errors.New("unknown member")
+	ErrIllegalGeneration    = errors.New("illegal generation")
+	ErrRebalanceInProgress  = errors.New("group is rebalancing, the member must join again")
+	ErrUnknownAssignor      = errors.New("unknown assignor")
+	ErrInconsistentAssignor = errors.New("assignor differs from the one of the group")
+)
+
+const defaultSessionTimeout = 10 * time.Second
+
+// expirationInterval is the period of checks for expired sessions and changed topics.
+const expirationInterval = 100 * time.Millisecond
+
+type member struct {
+	topics         []string
+	sessionTimeout time.Duration
+	heartbeat      time.Time
+
+	// generation is the one, the member has joined last, owned are partitions, it has got in it.
+	generation int64
+	owned      Assignment
+}
+
+type group struct {
+	mutex sync.Mutex
+
+	generation int64
+	assignor   string
+
+	members     map[string]*member
+	assignments map[string]Assignment
+	// partitions are amounts of partitions of topics, which were assigned in the current generation.
+	partitions map[string]int64
+}
+
+// Coordinator keeps members of consumer groups and divides partitions between them.
+// Every change of members starts a new generation, commits of older generations are rejected.
+// A partition, which is moved to another member, is withheld from it, until the previous owner
+// has joined the new generation or its session has expired, so two members never consume it at once.
+type Coordinator struct {
+	logger *slog.Logger
+
+	mutex     sync.Mutex
+	groups    map[string]*group
+	assignors map[string]Assignor
+
+	offsets *Offsets
+	topics  *registry.Registry
+	router  *deadletter.Router
+}
+
+// RegisterAssignor makes the assignor available for groups by the name.
+func (c *Coordinator) RegisterAssignor(name string, assignor Assignor) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.assignors[name] = assignor
+}
+
+// Join adds a member to the group, a known member gets its current assignment.
+// Partitions, which previous owners have not released yet, are left out of the assignment,
+// the member is asked to join again by Heartbeat, when they are released.
+func (c *Coordinator) Join(ctx context.Context, request topic.JoinGroupRequest) (topic.JoinGroupResponse, error) {
+	if request.Group == "" || len(request.Topics) == 0 {
+		return topic.JoinGroupResponse{}, ErrInvalidGroup
+	}
+
+	if request.Assignor != "" && c.assignor(request.Assignor) == nil {
+		return topic.JoinGroupResponse{}, ErrUnknownAssignor
+	}
+
+	g := c.lock(request.Group, request.MemberID == "")
+	if g == nil {
+		return topic.JoinGroupResponse{}, ErrUnknownMember
+	}
+	defer g.mutex.Unlock()
+
+	if len(g.members) == 0 {
+		g.assignor = request.Assignor
+		if g.assignor == "" {
+			g.assignor = RangeAssignor
+		}
+	} else if request.Assignor != "" && request.Assignor != g.assignor {
+		return topic.JoinGroupResponse{}, ErrInconsistentAssignor
+	}
+
+	timeout := request.SessionTimeout
+	if timeout <= 0 {
+		timeout = defaultSessionTimeout
+	}
+
+	topics := slices.Clone(request.Topics)
+	slices.Sort(topics)
+	topics = slices.Compact(topics)
+
+	id := request.MemberID
+	if id == "" {
+		id = newMemberID()
+		g.members[id] = &member{}
+		c.logger.Info("a member joined the group", "group", request.Group, "member", id)
+	}
+
+	m, ok := g.members[id]
+	if !ok {
+		return topic.JoinGroupResponse{}, ErrUnknownMember
+	}
+
+	changed := !slices.Equal(m.topics, topics)
+	m.topics, m.sessionTimeout, m.heartbeat = topics, timeout, time.Now()
+
+	if changed {
+		c.rebalance(request.Group, g)
+	}
+
+	m.generation, m.owned = g.generation, g.assignment(id)
+
+	return topic.JoinGroupResponse{
+		MemberID:   id,
+		Generation: g.generation,
+		Assignment: toTopicPartitions(m.owned),
+	}, nil
+}
+
+// Heartbeat keeps the member's session alive, a member of an older generation must join again.
+// A member, which waits for withheld partitions, must join again, when they are released.
+func (c *Coordinator) Heartbeat(ctx context.Context, request topic.HeartbeatRequest) (topic.HeartbeatResponse, error) {
+	g := c.lock(request.Group, false)
+	if g == nil {
+		return topic.HeartbeatResponse{}, ErrUnknownMember
+	}
+	defer g.mutex.Unlock()
+
+	m, ok := g.members[request.MemberID]
+	if !ok {
+		return topic.HeartbeatResponse{}, ErrUnknownMember
+	}
+
+	m.heartbeat = time.Now()
+
+	if request.Generation != g.generation || m.owned.size() != g.assignment(request.MemberID).size() {
+		return topic.HeartbeatResponse{}, ErrRebalanceInProgress
+	}
+
+	return topic.HeartbeatResponse{}, nil
+}
+
+func (c *Coordinator) Leave(ctx context.Context, request topic.LeaveGroupRequest) error {
+	g := c.lock(request.Group, false)
+	if g == nil {
+		return ErrUnknownMember
+	}
+	defer g.mutex.Unlock()
+
+	if _, ok := g.members[request.MemberID]; !ok {
+		return ErrUnknownMember
+	}
+
+	delete(g.members, request.MemberID)
+	c.logger.Info("a member left the group", "group", request.Group, "member", request.MemberID)
+
+	c.rebalance(request.Group, g)
+
+	return nil
+}
+
+// Commit commits the offset, if the member belongs to the current generation of the group.
+func (c *Coordinator) Commit(ctx context.Context, request topic.CommitOffsetRequest) (topic.CommitOffsetResponse, error) {
+	unlock, err := c.fence(request.Group, request.MemberID, request.Generation)
+	if err != nil {
+		return topic.CommitOffsetResponse{}, err
+	}
+	defer unlock()
+
+	return c.offsets.Commit(ctx, request)
+}
+
+// Reject moves the record, which the member has failed to process,
+// into the next retry topic or the dead letter topic of the record's topic.
+func (c *Coordinator) Reject(ctx context.Context, request topic.RejectRecordRequest) (topic.RejectRecordResponse, error) {
+	unlock, err := c.fence(request.Group, request.MemberID, request.Generation)
+	if err != nil {
+		return topic.RejectRecordResponse{}, err
+	}
+	defer unlock()
+
+	partitions, err := c.topics.Partitions(request.Topic)
+	if err != nil {
+		return topic.RejectRecordResponse{}, err
+	}
+
+	r, err := partitions.ReadByOffset(ctx, topic.ReadByOffsetFromPartitionRequest{Partition: request.Partition, Offset: request.Offset})
+	if err != nil {
+		return topic.RejectRecordResponse{}, err
+	}
+
+	destination, err := c.router.Forward(ctx, deadletter.Failure{
+		Topic:     request.Topic,
+		Partition: request.Partition,
+		Record:    r,
+		Reason:    request.Reason,
+		Attempts:  request.Attempts,
+	})
+	if err != nil {
+		return topic.RejectRecordResponse{}, err
+	}
+
+	return topic.RejectRecordResponse{Destination: destination}, nil
+}
+
+// fence checks, that the member belongs to the current generation of the group,
+// groups without members accept requests without a member.
+// The returned function must be called, when the request is done, the generation does not change until then.
+func (c *Coordinator) fence(name string, memberID string, generation int64) (func(), error) {
+	g := c.lock(name, false)
+	if g == nil {
+		if memberID != "" {
+			return nil, ErrUnknownMember
+		}
+
+		return func() {}, nil
+	}
+
+	if len(g.members) != 0 || memberID != "" {
+		if _, ok := g.members[memberID]; !ok {
+			g.mutex.Unlock()
+			return nil, ErrUnknownMember
+		}
+
+		if generation != g.generation {
+			g.mutex.Unlock()
+			c.logger.Warn("rejected a request of a stale member", "group", name, "member", memberID, "generation", generation)
+			return nil, ErrIllegalGeneration
+		}
+	}
+
+	return g.mutex.Unlock, nil
+}
+
+func (c *Coordinator) Fetch(ctx context.Context, request topic.FetchOffsetRequest) (topic.FetchOffsetResponse, error) {
+	return c.offsets.Fetch(ctx, request)
+}
+
+// rebalance starts a new generation of the group and assigns partitions to its members.
+func (c *Coordinator) rebalance(name string, g *group) {
+	g.generation++
+
+	members := make([]Member, 0, len(g.members))
+	for _, id := range sortedKeys(g.members) {
+		members = append(members, Member{ID: id, Topics: g.members[id].topics})
+	}
+
+	g.partitions = c.partitions(members)
+
+	assignor := c.assignor(g.assignor)
+	if assignor == nil {
+		assignor = rangeAssignor{}
+	}
+
+	g.assignments = assignor.Assign(members, g.partitions, g.assignments)
+	for _, assignment := range g.assignments {
+		for _, partitions := range assignment {
+			slices.Sort(partitions)
+		}
+	}
+
+	c.logger.Info("rebalanced the group", "group", name, "generation", g.generation, "members", len(members))
+}
+
+// assignment returns partitions of the member in the current generation without ones,
+// which are still owned by members of older generations.
+// Withheld partitions are only released inside a generation, so a grown size shows a release.
+func (g *group) assignment(id string) Assignment {
+	assignment := make(Assignment)
+	for name, partitions := range g.assignments[id] {
+		for _, partition := range partitions {
+			if !g.owned(id, name, partition) {
+				assignment.add(name, partition)
+			}
+		}
+	}
+
+	return assignment
+}
+
+// owned reports, whether another member of an older generation still owns the partition.
+func (g *group) owned(id string, name string, partition int64) bool {
+	for other, m := range g.members {
+		if other != id && m.generation != g.generation && slices.Contains(m.owned[name], partition) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// partitions returns amounts of partitions of topics, the members are subscribed to.
+func (c *Coordinator) partitions(members []Member) map[string]int64 {
+	partitions := make(map[string]int64)
+	for _, member := range members {
+		for _, name := range member.Topics {
+			if _, ok := partitions[name]; ok {
+				continue
+			}
+
+			manager, err := c.topics.Partitions(name)
+			if err != nil {
+				partitions[name] = 0
+				continue
+			}
+
+			partitions[name] = manager.Len()
+		}
+	}
+
+	return partitions
+}
+
+// expire removes members with expired sessions and rebalances groups, which topics have grown.
+func (c *Coordinator) expire(now time.Time) {
+	c.mutex.Lock()
+	groups := maps.Clone(c.groups)
+	c.mutex.Unlock()
+
+	for name, g := range groups {
+		g.mutex.Lock()
+
+		changed := false
+		for id, m := range g.members {
+			if now.Sub(m.heartbeat) > m.sessionTimeout {
+				c.logger.Info("a member session expired", "group", name, "member", id)
+				delete(g.members, id)
+				changed = true
+			}
+		}
+
+		members := make([]Member, 0, len(g.members))
+		for id, m := range g.members {
+			members = append(members, Member{ID: id, Topics: m.topics})
+		}
+
+		if changed || !maps.Equal(c.partitions(members), g.partitions) {
+			c.rebalance(name, g)
+		}
+
+		if len(g.members) == 0 {
+			c.mutex.Lock()
+			delete(c.groups, name)
+			c.mutex.Unlock()
+		}
+
+		g.mutex.Unlock()
+	}
+}
+
+func (c *Coordinator) run(ctx context.Context) {
+	ticker := time.NewTicker(expirationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.expire(now)
+		}
+	}
+}
+
+// lock returns the locked group by the name, it is created if the create is set.
+// Empty groups are removed by expire, so the group is checked to be still registered after it is locked.
+func (c *Coordinator) lock(name string, create bool) *group {
+	for {
+		g := c.group(name, create)
+		if g == nil {
+			return nil
+		}
+
+		g.mutex.Lock()
+
+		c.mutex.Lock()
+		registered := c.groups[name] == g
+		c.mutex.Unlock()
+
+		if registered {
+			return g
+		}
+
+		g.mutex.Unlock()
+	}
+}
+
+// group returns the group by the name, it is created if the create is set.
+func (c *Coordinator) group(name string, create bool) *group {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	g, ok := c.groups[name]
+	if !ok && create {
+		g = &group{
+			members:     make(map[string]*member),
+			assignments: make(map[string]Assignment),
+			partitions:  make(map[string]int64),
+		}
+		c.groups[name] = g
+	}
+
+	return g
+}
+
+func (c *Coordinator) assignor(name string) Assignor {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.assignors[name]
+}
+
+func toTopicPartitions(assignment Assignment) []topic.TopicPartitions {
+	result := make([]topic.TopicPartitions, 0, len(assignment))
+	for _, name := range sortedKeys(assignment) {
+		if len(assignment[name]) != 0 {
+			result = append(result, topic.TopicPartitions{Topic: name, Partitions: slices.Clone(assignment[name])})
+		}
+	}
+
+	return result
+}
+
+func newMemberID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return "member-" + hex.EncodeToString(id)
+}
+
+// NewCoordinator starts a coordinator, which checks sessions of members until the ctx is done.
+func NewCoordinator(ctx context.Context, logger *slog.Logger, topics *registry.Registry, offsets *Offsets) *Coordinator {
+	c := &Coordinator{
+		logger: logger,
+		groups: make(map[string]*group),
+		assignors: map[string]Assignor{
+			RangeAssignor:      rangeAssignor{},
+			RoundRobinAssignor: roundRobinAssignor{},
+			StickyAssignor:     stickyAssignor{},
+		},
+		offsets: offsets,
+		topics:  topics,
+		router:  deadletter.NewRouter(logger, topics),
+	}
+
+	go c.run(ctx)
+
+	return c
+}
@@ -0,0 +1,113 @@
+package group
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/indigowar/dmq/internal/partition"
+	"github.com/indigowar/dmq/internal/registry"
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+// Groups returns names of groups, which have committed offsets, in ascending order.
+func (o *Offsets) Groups() []string {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	var groups []string
+	for key := range o.committed {
+		if !slices.Contains(groups, key.Group) {
+			groups = append(groups, key.Group)
+		}
+	}
+	slices.Sort(groups)
+
+	return groups
+}
+
+// Lag reports how far the group is behind in every partition, it has committed an offset for.
+// Partitions of deleted topics are skipped.
+func (o *Offsets) Lag(ctx context.Context, request topic.GroupLagRequest) (topic.GroupLagResponse, error) {
+	o.mutex.RLock()
+	var keys []offsetKey
+	committed := make(map[offsetKey]int64)
+	for key, value := range o.committed {
+		if key.Group == request.Group {
+			keys = append(keys, key)
+			committed[key] = value.Offset
+		}
+	}
+	o.mutex.RUnlock()
+
+	slices.SortFunc(keys, func(a, b offsetKey) int {
+		return cmp.Or(cmp.Compare(a.Topic, b.Topic), cmp.Compare(a.Partition, b.Partition))
+	})
+
+	response := topic.GroupLagResponse{
+		Group:      request.Group,
+		Partitions: []topic.PartitionLag{},
+	}
+
+	for _, key := range keys {
+		lag, err := o.lag(ctx, key, committed[key])
+		if err != nil {
+			if errors.Is(err, registry.ErrTopicNotFound) || errors.Is(err, partition.ErrPartitionNotFound) {
+				continue
+			}
+
+			return topic.GroupLagResponse{}, err
+		}
+
+		response.Partitions = append(response.Partitions, lag)
+	}
+
+	return response, nil
+}
+
+func (o *Offsets) lag(ctx context.Context, key offsetKey, committed int64) (topic.PartitionLag, error) {
+	partitions, err := o.topics.Partitions(key.Topic)
+	if err != nil {
+		return topic.PartitionLag{}, err
+	}
+
+	watermark, err := partitions.HighWatermark(ctx, topic.HighWatermarkRequest{Partition: key.Partition})
+	if err != nil {
+		return topic.PartitionLag{}, err
+	}
+
+	lag := topic.PartitionLag{
+		Topic:         key.Topic,
+		Partition:     key.Partition,
+		Committed:     committed,
+		HighWatermark: watermark.NextOffset,
+		Lag:           max(watermark.NextOffset-committed, 0),
+	}
+
+	if lag.Lag == 0 {
+		return lag, nil
+	}
+
+	// the first record, which is not consumed, the committed one may be already removed by retention.
+	first, err := partitions.LowWatermark(ctx, topic.LowWatermarkRequest{Partition: key.Partition})
+	if err != nil {
+		return topic.PartitionLag{}, err
+	}
+
+	// the timestamp is taken from the timestamp index, so the log is not read.
+	next, err := partitions.OffsetTimestamp(ctx, topic.OffsetTimestampRequest{
+		Partition: key.Partition,
+		Offset:    max(committed, first.Offset),
+	})
+	if err != nil {
+		if errors.Is(err, partition.ErrRecordNotFound) {
+			return lag, nil
+		}
+		return topic.PartitionLag{}, err
+	}
+
+	lag.TimeLag = max(watermark.HeadTimestamp.Sub(next.Timestamp), 0)
+
+	return lag, nil
+}
@@ -0,0 +1,299 @@
+package group
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/indigowar/dmq/internal/compacted"
+	"github.com/indigowar/dmq/internal/partition"
+	"github.com/indigowar/dmq/internal/registry"
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+// OffsetsTopic is the internal topic, which stores committed offsets of all groups.
+const OffsetsTopic = "__consumer_offsets"
+
+var (
+	ErrInvalidGroup        = errors.New("invalid group")
+	ErrOffsetOutOfRange    = errors.New("offset is out of range")
+	ErrNoCommittedOffset   = errors.New("group has no committed offset")
+	ErrUnknownResetPolicy  = errors.New("unknown reset policy")
+	ErrCorruptedCommitData = errors.New("corrupted commit data")
+)
+
+// offsetKey identifies a committed offset, it is the key of the record in the offsets topic.
+type offsetKey struct {
+	Group     string `json:"group"`
+	Topic     string `json:"topic"`
+	Partition int64  `json:"partition"`
+}
+
+// committedOffset is the value of the record in the offsets topic.
+type committedOffset struct {
+	Offset    int64     `json:"offset"`
+	Metadata  string    `json:"metadata,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Offsets stores offsets, which are committed by consumer groups, in a compacted topic.
+// All committed offsets are kept in memory, the topic is read only on start.
+type Offsets struct {
+	logger *slog.Logger
+
+	mutex     sync.RWMutex
+	committed map[offsetKey]committedOffset
+
+	topics *registry.Registry
+	log    *compacted.Log
+}
+
+func (o *Offsets) Commit(ctx context.Context, request topic.CommitOffsetRequest) (topic.CommitOffsetResponse, error) {
+	if request.Group == "" {
+		return topic.CommitOffsetResponse{}, ErrInvalidGroup
+	}
+
+	partitions, err := o.topics.Partitions(request.Topic)
+	if err != nil {
+		return topic.CommitOffsetResponse{}, err
+	}
+
+	watermark, err := partitions.HighWatermark(ctx, topic.HighWatermarkRequest{Partition: request.Partition})
+	if err != nil {
+		return topic.CommitOffsetResponse{}, err
+	}
+
+	if request.Offset < 0 || request.Offset > watermark.NextOffset {
+		return topic.CommitOffsetResponse{}, fmt.Errorf("%w: %d is beyond %d", ErrOffsetOutOfRange, request.Offset, watermark.NextOffset)
+	}
+
+	key := offsetKey{Group: request.Group, Topic: request.Topic, Partition: request.Partition}
+	value := committedOffset{Offset: request.Offset, Metadata: request.Metadata, Timestamp: time.Now()}
+
+	if err := o.store(ctx, key, &value); err != nil {
+		return topic.CommitOffsetResponse{}, err
+	}
+
+	return topic.CommitOffsetResponse{Timestamp: value.Timestamp}, nil
+}
+
+func (o *Offsets) Fetch(ctx context.Context, request topic.FetchOffsetRequest) (topic.FetchOffsetResponse, error) {
+	o.mutex.RLock()
+	value, ok := o.committed[offsetKey{Group: request.Group, Topic: request.Topic, Partition: request.Partition}]
+	o.mutex.RUnlock()
+
+	if ok {
+		return topic.FetchOffsetResponse{Offset: value.Offset, Metadata: value.Metadata, Committed: true}, nil
+	}
+
+	offset, err := o.reset(ctx, request)
+	if err != nil {
+		return topic.FetchOffsetResponse{}, err
+	}
+
+	return topic.FetchOffsetResponse{Offset: offset}, nil
+}
+
+// reset chooses the offset of the group, which has not committed one, according to the policy.
+func (o *Offsets) reset(ctx context.Context, request topic.FetchOffsetRequest) (int64, error) {
+	partitions, err := o.topics.Partitions(request.Topic)
+	if err != nil {
+		return 0, err
+	}
+
+	switch request.Reset {
+	case "", topic.ResetToLatest:
+		response, err := partitions.HighWatermark(ctx, topic.HighWatermarkRequest{Partition: request.Partition})
+		return response.NextOffset, err
+	case topic.ResetToEarliest:
+		response, err := partitions.LowWatermark(ctx, topic.LowWatermarkRequest{Partition: request.Partition})
+		return response.Offset, err
+	case topic.ResetByTimestamp:
+		response, err := partitions.ReadByTimestamp(ctx, topic.ReadByTimestampFromPartitionRequest{
+			Partition: request.Partition,
+			Timestamp: request.Timestamp,
+		})
+		if errors.Is(err, partition.ErrRecordNotFound) {
+			// all records are older, so the group starts with new ones.
+			watermark, err := partitions.HighWatermark(ctx, topic.HighWatermarkRequest{Partition: request.Partition})
+			return watermark.NextOffset, err
+		}
+
+		return response.Offset, err
+	case topic.ResetToNone:
+		return 0, ErrNoCommittedOffset
+	}
+
+	return 0, ErrUnknownResetPolicy
+}
+
+// Delete removes committed offsets of the group for all partitions of the topic.
+func (o *Offsets) Delete(ctx context.Context, request topic.DeleteOffsetsRequest) error {
+	o.mutex.RLock()
+	var keys []offsetKey
+	for key := range o.committed {
+		if key.Group == request.Group && key.Topic == request.Topic {
+			keys = append(keys, key)
+		}
+	}
+	o.mutex.RUnlock()
+
+	for _, key := range keys {
+		if err := o.store(ctx, key, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forget removes committed offsets of all groups for the deleted topic.
+func (o *Offsets) forget(ctx context.Context, name string) error {
+	o.mutex.RLock()
+	var keys []offsetKey
+	for key := range o.committed {
+		if key.Topic == name {
+			keys = append(keys, key)
+		}
+	}
+	o.mutex.RUnlock()
+
+	for _, key := range keys {
+		if err := o.store(ctx, key, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// store writes the offset into the offsets topic, nil value writes a tombstone.
+func (o *Offsets) store(ctx context.Context, key offsetKey, value *committedOffset) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	var encoded []byte
+	if value != nil {
+		if encoded, err = json.Marshal(value); err != nil {
+			return err
+		}
+	}
+
+	// the lock keeps the order of records in the topic the same as the order of updates in memory.
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if err := o.log.Put(ctx, data, encoded); err != nil {
+		o.logger.Error("failed to store an offset", "group", key.Group, "topic", key.Topic, "partition", key.Partition, "err", err)
+		return err
+	}
+
+	if value != nil {
+		o.committed[key] = *value
+	} else {
+		delete(o.committed, key)
+	}
+
+	return nil
+}
+
+// topicNames returns names of topics, which have committed offsets.
+func (o *Offsets) topicNames() []string {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	var names []string
+	for key := range o.committed {
+		if !slices.Contains(names, key.Topic) {
+			names = append(names, key.Topic)
+		}
+	}
+
+	return names
+}
+
+// load restores committed offsets from the offsets topic.
+func (o *Offsets) load(ctx context.Context) error {
+	return o.log.Load(ctx, func(data []byte, encoded []byte) error {
+		var key offsetKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return fmt.Errorf("%w: %w", ErrCorruptedCommitData, err)
+		}
+
+		if len(encoded) == 0 {
+			delete(o.committed, key)
+			return nil
+		}
+
+		var value committedOffset
+		if err := json.Unmarshal(encoded, &value); err != nil {
+			return fmt.Errorf("%w: %w", ErrCorruptedCommitData, err)
+		}
+
+		o.committed[key] = value
+		return nil
+	})
+}
+
+// NewOffsets loads committed offsets, the offsets topic is created, if it does not exist.
+func NewOffsets(ctx context.Context, logger *slog.Logger, topics *registry.Registry) (*Offsets, error) {
+	log, err := compacted.Open(ctx, logger, topics, OffsetsTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := loadOffsets(ctx, logger, topics, log)
+	if err != nil {
+		return nil, err
+	}
+
+	// offsets of topics, which were deleted without the hook finishing, are removed on start.
+	for _, name := range o.topicNames() {
+		if _, err := topics.Config(name); !errors.Is(err, registry.ErrTopicNotFound) {
+			continue
+		}
+
+		if err := o.forget(ctx, name); err != nil {
+			logger.Error("failed to remove offsets of a deleted topic", "topic", name, "err", err)
+			return nil, err
+		}
+	}
+
+	topics.OnDelete(o.forget)
+
+	return o, nil
+}
+
+// NewReadOnlyOffsets loads committed offsets to inspect them, offsets can not be committed,
+// and offsets of deleted topics are not removed. It returns registry.ErrTopicNotFound, if the offsets topic does not exist.
+func NewReadOnlyOffsets(ctx context.Context, logger *slog.Logger, topics *registry.Registry) (*Offsets, error) {
+	log, err := compacted.OpenReadOnly(logger, topics, OffsetsTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadOffsets(ctx, logger, topics, log)
+}
+
+func loadOffsets(ctx context.Context, logger *slog.Logger, topics *registry.Registry, log *compacted.Log) (*Offsets, error) {
+	o := &Offsets{
+		logger:    logger,
+		committed: make(map[offsetKey]committedOffset),
+		topics:    topics,
+		log:       log,
+	}
+
+	if err := o.load(ctx); err != nil {
+		logger.Error("failed to load committed offsets", "err", err)
+		return nil, err
+	}
+
+	return o, nil
+}
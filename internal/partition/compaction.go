@@ -0,0 +1,302 @@
+package partition
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/indigowar/dmq/internal/core/communication"
+	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/partition/index"
+)
+
+// compactionBatch is the amount of records in a batch of a compacted log.
+const compactionBatch = 512
+
+// DefaultDeleteRetention is used, when the DeleteRetention of a partition is not configured.
+const DefaultDeleteRetention = 24 * time.Hour
+
+// latestRecord is the latest record of a key, keep tells whether it survives the compaction.
+type latestRecord struct {
+	offset int64
+	keep   bool
+}
+
+// Compact rewrites inactive logs, so they keep only the latest record of every key.
+// A record with an empty value is a tombstone: it removes the key completely.
+// The tombstone itself is kept, until it has passed one compaction and the DeleteRetention,
+// so consumers, which are behind, see the deletion. Expired records are removed as well.
+// Offsets of the kept records are not changed, records without a key are kept until they expire.
+//
+// Logs are read and written without blocking writers, the lock is taken only to replace the logs.
+// It returns the amount of removed records.
+func (p *partition) Compact(ctx context.Context) (int64, error) {
+	p.compacting.Lock()
+	defer p.compacting.Unlock()
+
+	v := p.snapshot()
+	if len(v.logs) < 2 {
+		return 0, nil
+	}
+
+	sealed := v.logs[:len(v.logs)-1]
+	activeOffset, err := p.firstOffset(ctx, v.logs[len(v.logs)-1])
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		now       = time.Now()
+		retention = cmp.Or(p.DeleteRetention, DefaultDeleteRetention)
+		// only compactions change the cleaned offset, so it can be read without the lock.
+		cleaned = p.CleanedOffset
+	)
+
+	keep := func(r record.Record) bool {
+		switch {
+		case r.Expired(now):
+			return false
+		case len(r.Key) == 0 || len(r.Value) != 0:
+			return true
+		default:
+			return r.Offset >= cleaned || now.Sub(r.Timestamp) < retention
+		}
+	}
+
+	// the first pass finds the latest record of every key, the active log is read as well.
+	var (
+		latest       = make(map[string]latestRecord)
+		total, kept  int64
+		countKeyless = func(r record.Record) {
+			if r.Offset < activeOffset {
+				total++
+				if len(r.Key) == 0 && keep(r) {
+					kept++
+				}
+			}
+		}
+	)
+	if err := p.scanLogs(ctx, v.logs, v.highWatermark, func(r record.Record) error {
+		countKeyless(r)
+		if len(r.Key) != 0 {
+			latest[string(r.Key)] = latestRecord{offset: r.Offset, keep: keep(r)}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	for _, l := range latest {
+		if l.offset < activeOffset && l.keep {
+			kept++
+		}
+	}
+
+	removed := total - kept
+	if removed == 0 {
+		return 0, nil
+	}
+
+	p.logger.Info("compacting the partition", "partition", p.Number, "logs", len(sealed), "removed", removed)
+
+	// the second pass writes the kept records of sealed logs into a new log.
+	if ctx.Err() != nil {
+		return 0, communication.ErrOperationIsCancelled
+	}
+
+	compacted := &compactedLog{p: p, ctx: context.WithoutCancel(ctx), number: -1, maxTimestamp: math.MinInt64}
+	if err := p.scanLogs(ctx, sealed, activeOffset, func(r record.Record) error {
+		if len(r.Key) == 0 && keep(r) {
+			return compacted.add(r)
+		}
+
+		if l := latest[string(r.Key)]; len(r.Key) != 0 && l.offset == r.Offset && l.keep {
+			return compacted.add(r)
+		}
+		return nil
+	}); err != nil {
+		compacted.remove()
+		return 0, err
+	}
+
+	if err := compacted.seal(); err != nil {
+		p.logger.Error("failed to write a compacted log", "partition", p.Number, "err", err)
+		compacted.remove()
+		return 0, err
+	}
+
+	if err := p.replaceLogs(sealed, compacted.logs(), activeOffset); err != nil {
+		compacted.remove()
+		return 0, err
+	}
+
+	var errs []error
+	for _, number := range sealed {
+		errs = append(errs,
+			p.files.Remove(p.logPath(number)),
+			p.index.Remove(ctx, p.offsetIndexPath(number)),
+			p.index.Remove(ctx, p.timestampIndexPath(number)),
+		)
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// replaceLogs replaces the sealed logs with the compacted ones, if the partition still starts with them.
+func (p *partition) replaceLogs(sealed []int64, compacted []int64, cleanedOffset int64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.Logs) <= len(sealed) || !slices.Equal(p.Logs[:len(sealed)], sealed) {
+		return ErrLogsChanged
+	}
+
+	logs, cleaned := p.Logs, p.CleanedOffset
+
+	p.Logs = append(compacted, p.Logs[len(sealed):]...)
+	p.CleanedOffset = cleanedOffset
+
+	if err := p.dump(); err != nil {
+		p.logger.Error("failed to dump the partition", "err", err)
+
+		p.Logs, p.CleanedOffset = logs, cleaned
+		return err
+	}
+
+	p.publish()
+
+	return nil
+}
+
+// scanLogs calls fn for every record of the logs before the end offset.
+func (p *partition) scanLogs(ctx context.Context, logs []int64, end int64, fn func(record.Record) error) error {
+	for _, log := range logs {
+		stream := p.log.Scan(ctx, p.logPath(log), 0, scanBuffer)
+		for {
+			r, ok := stream.Next(ctx)
+			if !ok {
+				break
+			}
+
+			if r.Offset >= end {
+				stream.Close()
+				return nil
+			}
+
+			if err := fn(r); err != nil {
+				stream.Close()
+				return err
+			}
+		}
+
+		if err := stream.Err(); err != nil {
+			p.logger.Error("scanning a log failed", "log", log, "err", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compactedLog is a new log, which is written by a compaction.
+// Like an append, its writes are not cancelled, so ctx is never cancelled.
+type compactedLog struct {
+	p   *partition
+	ctx context.Context
+
+	// number is -1, until the log is created.
+	number       int64
+	maxTimestamp int64
+
+	batch []record.Record
+	size  int64
+}
+
+// add appends the record to the current batch, the batch takes up to half of the maximum entry size,
+// which leaves room for the encoding of records.
+func (c *compactedLog) add(r record.Record) error {
+	size := payloadSize(record.RecordCreationPayload{Key: r.Key, Value: r.Value, Headers: r.Headers})
+
+	if len(c.batch) == compactionBatch || (len(c.batch) != 0 && c.size+size > c.p.log.MaxEntrySize()/2) {
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+
+	c.batch = append(c.batch, r)
+	c.size += size
+
+	return nil
+}
+
+func (c *compactedLog) flush() error {
+	if len(c.batch) == 0 {
+		return nil
+	}
+
+	var (
+		position int64
+		err      error
+	)
+	if c.number == -1 {
+		// the log is created under the writer's lock, so a new log of an append does not take its number.
+		c.p.mutex.Lock()
+		number, pos, err := c.p.log.WriteNew(c.ctx, c.p.path, logExt, c.batch, c.p.encoding())
+		c.p.mutex.Unlock()
+
+		if err != nil {
+			return err
+		}
+		c.number, position = number, pos
+	} else if position, err = c.p.log.Write(c.ctx, c.p.logPath(c.number), c.batch, c.p.encoding()); err != nil {
+		return err
+	}
+
+	for _, r := range c.batch {
+		c.maxTimestamp = max(c.maxTimestamp, r.Timestamp.UnixNano())
+	}
+
+	if err := errors.Join(
+		c.p.index.Insert(c.ctx, c.p.timestampIndexPath(c.number), index.Pair{Key: c.maxTimestamp, Value: c.batch[0].Offset}),
+		c.p.index.Insert(c.ctx, c.p.offsetIndexPath(c.number), index.Pair{Key: c.batch[0].Offset, Value: position}),
+	); err != nil {
+		return err
+	}
+
+	c.batch, c.size = c.batch[:0], 0
+	return nil
+}
+
+// seal writes the rest of records and seals indexes of the log.
+func (c *compactedLog) seal() error {
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	if c.number == -1 {
+		return nil
+	}
+
+	return errors.Join(
+		c.p.index.Seal(c.ctx, c.p.offsetIndexPath(c.number)),
+		c.p.index.Seal(c.ctx, c.p.timestampIndexPath(c.number)),
+	)
+}
+
+// logs returns the log, if any record is kept.
+func (c *compactedLog) logs() []int64 {
+	if c.number == -1 {
+		return nil
+	}
+
+	return []int64{c.number}
+}
+
+func (c *compactedLog) remove() {
+	if c.number != -1 {
+		c.p.removeNewLog(c.ctx, c.number)
+	}
+}
@@ -0,0 +1,214 @@
+package partition
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/indigowar/dmq/internal/core/communication"
+	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/partition/files"
+	"github.com/indigowar/dmq/internal/partition/index"
+	"github.com/indigowar/dmq/internal/partition/log"
+)
+
+func newTestPartition(t *testing.T, config Config) *partition {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	var (
+		pool   = communication.PoolConfig{Min: 1, Max: 2}
+		cache  = files.NewCache(16)
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	)
+	t.Cleanup(cache.Close)
+
+	p, err := newPartition(logger, t.TempDir(), 0, config, index.InitIndex(ctx, pool, cache), log.InitLog(ctx, pool, cache, log.DefaultMaxEntrySize), cache)
+	if err != nil {
+		t.Fatalf("failed to create a partition: %v", err)
+	}
+
+	return p
+}
+
+// reload loads the partition from its directory, as it is done on a restart.
+func reload(t *testing.T, p *partition) *partition {
+	t.Helper()
+
+	loaded, err := loadPartition(p.logger, p.path, p.Number, p.index, p.log, p.files, false)
+	if err != nil {
+		t.Fatalf("failed to load the partition: %v", err)
+	}
+
+	return loaded
+}
+
+// write writes records with the keys, an empty value is written for the keys in tombstones.
+func write(t *testing.T, p *partition, keys []string, tombstones ...string) {
+	t.Helper()
+
+	for i, key := range keys {
+		payload := record.RecordCreationPayload{Key: []byte(key), Value: []byte{byte(i)}}
+		if slices.Contains(tombstones, key) {
+			payload.Value = nil
+		}
+
+		if _, _, err := p.Write(context.Background(), payload); err != nil {
+			t.Fatalf("failed to write a record: %v", err)
+		}
+	}
+}
+
+// offsets returns offsets of all records in the partition.
+func offsets(t *testing.T, p *partition) []int64 {
+	t.Helper()
+
+	records, _, err := p.ReadRange(context.Background(), 0, math.MaxInt32, false)
+	if err != nil {
+		t.Fatalf("failed to read the partition: %v", err)
+	}
+
+	offsets := make([]int64, 0, len(records))
+	for _, r := range records {
+		offsets = append(offsets, r.Offset)
+	}
+
+	return offsets
+}
+
+func compact(t *testing.T, p *partition) int64 {
+	t.Helper()
+
+	removed, err := p.Compact(context.Background())
+	if err != nil {
+		t.Fatalf("failed to compact the partition: %v", err)
+	}
+
+	return removed
+}
+
+func checkOffsets(t *testing.T, p *partition, expected []int64) {
+	t.Helper()
+
+	if actual := offsets(t, p); !slices.Equal(actual, expected) {
+		t.Fatalf("expected offsets %v, got %v", expected, actual)
+	}
+}
+
+func TestCompactKeepsLatestRecords(t *testing.T) {
+	p := newTestPartition(t, Config{LogSize: 4})
+
+	// offsets 8 and 9 are in the active log, it is not compacted.
+	write(t, p, []string{"a", "b", "a", "c", "b", "a", "d", "c", "b", "a"})
+	if _, _, err := p.Write(context.Background(), record.RecordCreationPayload{Value: []byte("keyless")}); err != nil {
+		t.Fatalf("failed to write a record: %v", err)
+	}
+
+	if removed := compact(t, p); removed != 6 {
+		t.Fatalf("expected 6 removed records, got %d", removed)
+	}
+
+	checkOffsets(t, p, []int64{6, 7, 8, 9, 10})
+
+	r, err := p.ReadByOffset(context.Background(), 6)
+	if err != nil || string(r.Key) != "d" {
+		t.Fatalf("expected the record of the key d, got %v: %v", r, err)
+	}
+
+	if _, err := p.ReadByOffset(context.Background(), 5); err != ErrRecordNotFound {
+		t.Fatalf("expected a removed record to be not found, got %v", err)
+	}
+
+	if removed := compact(t, p); removed != 0 {
+		t.Fatalf("expected a compacted partition to stay the same, %d records are removed", removed)
+	}
+
+	checkOffsets(t, reload(t, p), []int64{6, 7, 8, 9, 10})
+}
+
+func TestCompactRetainsTombstones(t *testing.T) {
+	p := newTestPartition(t, Config{LogSize: 2, DeleteRetention: time.Hour})
+
+	// the tombstone of a is at the offset 1, the active log starts at the offset 4.
+	write(t, p, []string{"a", "a", "b", "b", "c"}, "a")
+
+	compact(t, p)
+	checkOffsets(t, p, []int64{1, 3, 4})
+
+	// the tombstone has passed a compaction, but not the retention.
+	compact(t, p)
+	checkOffsets(t, p, []int64{1, 3, 4})
+
+	p.DeleteRetention = time.Nanosecond
+	if removed := compact(t, p); removed != 1 {
+		t.Fatalf("expected the tombstone to be removed, %d records are removed", removed)
+	}
+	checkOffsets(t, p, []int64{3, 4})
+}
+
+func TestCompactKeepsNewTombstones(t *testing.T) {
+	p := newTestPartition(t, Config{LogSize: 2, DeleteRetention: time.Nanosecond})
+
+	write(t, p, []string{"a", "a", "b"}, "a")
+
+	// the tombstone is after the cleaned offset, so consumers have not had a chance to see it.
+	compact(t, p)
+	checkOffsets(t, p, []int64{1, 2})
+
+	write(t, p, []string{"c", "d"})
+
+	compact(t, p)
+	checkOffsets(t, p, []int64{2, 3, 4})
+}
+
+func TestCompactSavesCleanedOffset(t *testing.T) {
+	p := newTestPartition(t, Config{LogSize: 2, DeleteRetention: time.Hour})
+
+	write(t, p, []string{"a", "a", "b", "b", "c"}, "a")
+	compact(t, p)
+
+	p = reload(t, p)
+	if p.CleanedOffset != 4 {
+		t.Fatalf("expected the cleaned offset 4, got %d", p.CleanedOffset)
+	}
+
+	checkOffsets(t, p, []int64{1, 3, 4})
+}
+
+func TestLoadRemovesUnfinishedCompaction(t *testing.T) {
+	p := newTestPartition(t, Config{LogSize: 2})
+
+	write(t, p, []string{"a", "a", "b"})
+
+	// a crash after the compacted log is written, but before it replaces the sealed logs.
+	compacted := &compactedLog{p: p, ctx: context.Background(), number: -1, maxTimestamp: math.MinInt64}
+	r, err := p.ReadByOffset(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("failed to read a record: %v", err)
+	}
+
+	if err := compacted.add(r); err != nil {
+		t.Fatalf("failed to write a compacted log: %v", err)
+	}
+
+	if err := compacted.seal(); err != nil {
+		t.Fatalf("failed to seal a compacted log: %v", err)
+	}
+
+	p = reload(t, p)
+
+	for _, path := range []string{p.logPath(compacted.number), p.offsetIndexPath(compacted.number), p.timestampIndexPath(compacted.number)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed, got %v", path, err)
+		}
+	}
+
+	checkOffsets(t, p, []int64{0, 1, 2})
+}
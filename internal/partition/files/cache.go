@@ -0,0 +1,198 @@
+package files
+
+import (
+	"container/list"
+	"errors"
+	"os"
+	"sync"
+)
+
+var (
+	ErrCacheIsClosed = errors.New("file cache is closed")
+)
+
+// Cache keeps a bounded amount of open files, the least recently used are closed first.
+// Pinned files are never closed by the cache, they can exceed the capacity.
+type Cache struct {
+	mutex    sync.Mutex
+	capacity int
+	closed   bool
+
+	handles map[string]*Handle
+	pinned  map[string]struct{}
+	lru     *list.List
+}
+
+// Handle is an open file, acquired from the Cache.
+// It has to be released after usage, the file must not be closed by the user.
+type Handle struct {
+	cache   *Cache
+	path    string
+	file    *os.File
+	refs    int
+	element *list.Element
+
+	// detached is set when the handle is removed from the cache,
+	// but is still in use, the file is closed by the last Release.
+	detached bool
+}
+
+func (h *Handle) File() *os.File {
+	return h.file
+}
+
+func (h *Handle) Release() {
+	h.cache.mutex.Lock()
+	defer h.cache.mutex.Unlock()
+
+	h.refs--
+	if h.detached && h.refs == 0 {
+		h.file.Close()
+	}
+}
+
+// Acquire returns a handle for the file at the path, opened for reading and appending.
+// If create is false, the file has to exist.
+func (c *Cache) Acquire(path string, create bool) (*Handle, error) {
+	if h, err := c.lookup(path); h != nil || err != nil {
+		return h, err
+	}
+
+	flag := os.O_RDWR | os.O_APPEND
+	if create {
+		flag |= os.O_CREATE
+	}
+
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		file.Close()
+		return nil, ErrCacheIsClosed
+	}
+
+	// someone could open the same file in the meantime.
+	if h, ok := c.handles[path]; ok {
+		file.Close()
+		h.refs++
+		c.lru.MoveToFront(h.element)
+		return h, nil
+	}
+
+	h := &Handle{
+		cache: c,
+		path:  path,
+		file:  file,
+		refs:  1,
+	}
+	h.element = c.lru.PushFront(h)
+	c.handles[path] = h
+
+	c.evict()
+
+	return h, nil
+}
+
+// Pin keeps the file open until Unpin, even if it is the least recently used one.
+func (c *Cache) Pin(path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pinned[path] = struct{}{}
+}
+
+func (c *Cache) Unpin(path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.pinned, path)
+	c.evict()
+}
+
+// Remove closes the file, when it is no longer in use, and deletes it.
+func (c *Cache) Remove(path string) error {
+	c.mutex.Lock()
+	delete(c.pinned, path)
+	if h, ok := c.handles[path]; ok {
+		c.detach(h)
+	}
+	c.mutex.Unlock()
+
+	return os.Remove(path)
+}
+
+// Len returns the amount of open files.
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.handles)
+}
+
+// Close closes all files, which are not in use, the others are closed on release.
+func (c *Cache) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+	for _, h := range c.handles {
+		c.detach(h)
+	}
+}
+
+func (c *Cache) lookup(path string) (*Handle, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return nil, ErrCacheIsClosed
+	}
+
+	h, ok := c.handles[path]
+	if !ok {
+		return nil, nil
+	}
+
+	h.refs++
+	c.lru.MoveToFront(h.element)
+
+	return h, nil
+}
+
+func (c *Cache) evict() {
+	element := c.lru.Back()
+	for len(c.handles) > c.capacity && element != nil {
+		h := element.Value.(*Handle)
+		element = element.Prev()
+
+		if _, ok := c.pinned[h.path]; ok {
+			continue
+		}
+
+		c.detach(h)
+	}
+}
+
+func (c *Cache) detach(h *Handle) {
+	delete(c.handles, h.path)
+	c.lru.Remove(h.element)
+
+	h.detached = true
+	if h.refs == 0 {
+		h.file.Close()
+	}
+}
+
+func NewCache(capacity int) *Cache {
+	return &Cache{
+		capacity: max(capacity, 1),
+		handles:  make(map[string]*Handle),
+		pinned:   make(map[string]struct{}),
+		lru:      list.New(),
+	}
+}
@@ -0,0 +1,50 @@
+package files
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// TempExt is added to the name of a file, while it is being replaced.
+const TempExt = ".tmp"
+
+// WriteFile replaces the file atomically: the data is written into a temporary file,
+// which is synced and renamed, so a crash leaves either the old or the new content.
+func WriteFile(path string, data []byte) error {
+	temp := path + TempExt
+
+	file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		return errors.Join(err, file.Close(), os.Remove(temp))
+	}
+
+	if err := file.Sync(); err != nil {
+		return errors.Join(err, file.Close(), os.Remove(temp))
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.Join(err, os.Remove(temp))
+	}
+
+	if err := os.Rename(temp, path); err != nil {
+		return errors.Join(err, os.Remove(temp))
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir makes the rename durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
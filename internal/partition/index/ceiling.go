@@ -0,0 +1,33 @@
+package index
+
+import (
+	"context"
+	"io"
+	"sort"
+)
+
+type ceilingRequest struct {
+	Filename string `json:"filename"`
+	Key      int64  `json:"key"`
+}
+
+// ceiling finds the first pair with a key equal or greater than requested,
+// keys in the file have to be sorted.
+func ceiling(ctx context.Context, tables *tables, request ceilingRequest) (Pair, error) {
+	var response Pair
+
+	err := tables.view(request.Filename, func(pairs []Pair) error {
+		i := sort.Search(len(pairs), func(i int) bool {
+			return pairs[i].Key >= request.Key
+		})
+
+		if i == len(pairs) {
+			return io.EOF
+		}
+
+		response = pairs[i]
+		return nil
+	})
+
+	return response, err
+}
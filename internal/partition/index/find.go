@@ -1,10 +1,8 @@
 package index
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
-	"os"
+	"io"
 )
 
 type findRequest struct {
@@ -16,28 +14,19 @@ type findResponse struct {
 	Value int64 `json:"value"`
 }
 
-func find(ctx context.Context, request findRequest) (findResponse, error) {
-	file, err := os.OpenFile(request.Filename, os.O_RDONLY, 0644)
-	if err != nil {
-		return findResponse{}, err
-	}
-	defer file.Close()
+func find(ctx context.Context, tables *tables, request findRequest) (findResponse, error) {
+	var response findResponse
 
-	position := int64(0)
-	buffer := make([]byte, pairSize)
-	for {
-		if _, err := file.ReadAt(buffer, position); err != nil {
-			return findResponse{}, err
+	err := tables.view(request.Filename, func(pairs []Pair) error {
+		for _, pair := range pairs {
+			if pair.Key == request.Key {
+				response.Value = pair.Value
+				return nil
+			}
 		}
 
-		var pair Pair
-		reader := bytes.NewReader(buffer)
-		if err := binary.Read(reader, binary.NativeEndian, &pair); err != nil {
-			return findResponse{}, err
-		}
+		return io.EOF
+	})
 
-		if pair.Key == request.Key {
-			return findResponse{Value: pair.Value}, nil
-		}
-	}
+	return response, err
 }
@@ -0,0 +1,33 @@
+package index
+
+import (
+	"context"
+	"io"
+	"sort"
+)
+
+type floorRequest struct {
+	Filename string `json:"filename"`
+	Key      int64  `json:"key"`
+}
+
+// floor finds the last pair with a key equal or less than requested,
+// keys in the file have to be sorted.
+func floor(ctx context.Context, tables *tables, request floorRequest) (Pair, error) {
+	var response Pair
+
+	err := tables.view(request.Filename, func(pairs []Pair) error {
+		i := sort.Search(len(pairs), func(i int) bool {
+			return pairs[i].Key > request.Key
+		})
+
+		if i == 0 {
+			return io.EOF
+		}
+
+		response = pairs[i-1]
+		return nil
+	})
+
+	return response, err
+}
@@ -0,0 +1,33 @@
+package index
+
+import (
+	"context"
+	"io"
+	"sort"
+)
+
+type floorValueRequest struct {
+	Filename string `json:"filename"`
+	Value    int64  `json:"value"`
+}
+
+// floorValue finds the last pair with a value equal or less than requested,
+// values in the file have to be sorted.
+func floorValue(ctx context.Context, tables *tables, request floorValueRequest) (Pair, error) {
+	var response Pair
+
+	err := tables.view(request.Filename, func(pairs []Pair) error {
+		i := sort.Search(len(pairs), func(i int) bool {
+			return pairs[i].Value > request.Value
+		})
+
+		if i == 0 {
+			return io.EOF
+		}
+
+		response = pairs[i-1]
+		return nil
+	})
+
+	return response, err
+}
@@ -2,8 +2,7 @@ package index
 
 import (
 	"context"
-	"encoding/binary"
-	"os"
+	"errors"
 )
 
 type insertRequest struct {
@@ -11,16 +10,36 @@ type insertRequest struct {
 	Data     Pair   `json:"data"`
 }
 
-func Insert(ctx context.Context, request insertRequest) (noResponse, error) {
-	file, err := os.OpenFile(request.Filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+func Insert(ctx context.Context, tables *tables, request insertRequest) (noResponse, error) {
+	handle, err := tables.files.Acquire(request.Filename, true)
 	if err != nil {
 		return noResponse{}, err
 	}
-	defer file.Close()
+	defer handle.Release()
 
-	if err := binary.Write(file, binary.NativeEndian, request.Data); err != nil {
-		return noResponse{}, err
-	}
+	for {
+		table, err := tables.active(request.Filename)
+		if err != nil {
+			return noResponse{}, err
+		}
+
+		table.mutex.Lock()
+		if table.closed {
+			// the table is sealed or removed meanwhile.
+			table.mutex.Unlock()
+			continue
+		}
 
-	return noResponse{}, nil
+		if _, err := handle.File().Write(pairToBinary(request.Data)); err != nil {
+			// do not leave a partially written pair behind.
+			err = errors.Join(err, handle.File().Truncate(int64(len(table.pairs))*pairSize))
+			table.mutex.Unlock()
+			return noResponse{}, err
+		}
+
+		table.pairs = append(table.pairs, request.Data)
+		table.mutex.Unlock()
+
+		return noResponse{}, nil
+	}
 }
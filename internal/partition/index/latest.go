@@ -1,39 +1,25 @@
 package index
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
 	"io"
-	"os"
 )
 
 type latestRequest struct {
 	Filename string `json:"filename"`
 }
 
-func latest(ctx context.Context, request latestRequest) (Pair, error) {
-	file, err := os.OpenFile(request.Filename, os.O_RDONLY, 0644)
-	if err != nil {
-		return Pair{}, err
-	}
-	defer file.Close()
-
-	if _, err := file.Seek(pairSize, io.SeekEnd); err != nil {
-		return Pair{}, err
-	}
-
-	buffer := make([]byte, pairSize)
-	if _, err := file.Read(buffer); err != nil {
-		return Pair{}, err
-	}
-
+func latest(ctx context.Context, tables *tables, request latestRequest) (Pair, error) {
 	var response Pair
 
-	reader := bytes.NewReader(buffer)
-	if err := binary.Read(reader, binary.NativeEndian, &response); err != nil {
-		return Pair{}, err
-	}
+	err := tables.view(request.Filename, func(pairs []Pair) error {
+		if len(pairs) == 0 {
+			return io.EOF
+		}
+
+		response = pairs[len(pairs)-1]
+		return nil
+	})
 
-	return response, nil
+	return response, err
 }
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package index
+
+import (
+	"io"
+	"os"
+)
+
+// mmap falls back to reading the whole file on platforms without mmap.
+func mmap(file *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,13 @@
+package index
+
+import (
+	"context"
+)
+
+type removeRequest struct {
+	Filename string `json:"filename"`
+}
+
+func remove(ctx context.Context, tables *tables, request removeRequest) (noResponse, error) {
+	return noResponse{}, tables.remove(request.Filename)
+}
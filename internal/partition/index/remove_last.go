@@ -0,0 +1,53 @@
+package index
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrUnexpectedPair = errors.New("the last pair is not the expected one")
+)
+
+type removeLastRequest struct {
+	Filename string `json:"filename"`
+	Data     Pair   `json:"data"`
+}
+
+// removeLast reverts an insert, the last pair has to be equal to the requested one.
+func removeLast(ctx context.Context, tables *tables, request removeLastRequest) (noResponse, error) {
+	handle, err := tables.files.Acquire(request.Filename, false)
+	if err != nil {
+		return noResponse{}, err
+	}
+	defer handle.Release()
+
+	for {
+		table, err := tables.active(request.Filename)
+		if err != nil {
+			return noResponse{}, err
+		}
+
+		table.mutex.Lock()
+		if table.closed {
+			table.mutex.Unlock()
+			continue
+		}
+
+		size := len(table.pairs)
+		if size == 0 || table.pairs[size-1] != request.Data {
+			table.mutex.Unlock()
+			return noResponse{}, ErrUnexpectedPair
+		}
+
+		if err := handle.File().Truncate(int64(size-1) * pairSize); err != nil {
+			table.mutex.Unlock()
+			return noResponse{}, err
+		}
+
+		table.pairs = table.pairs[:size-1]
+		table.mutex.Unlock()
+
+		return noResponse{}, nil
+	}
+}
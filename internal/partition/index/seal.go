@@ -0,0 +1,13 @@
+package index
+
+import (
+	"context"
+)
+
+type sealRequest struct {
+	Filename string `json:"filename"`
+}
+
+func seal(ctx context.Context, tables *tables, request sealRequest) (noResponse, error) {
+	return noResponse{}, tables.seal(request.Filename)
+}
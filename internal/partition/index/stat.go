@@ -2,7 +2,6 @@ package index
 
 import (
 	"context"
-	"os"
 )
 
 type statRequest struct {
@@ -13,13 +12,13 @@ type Stat struct {
 	Size int64 `json:"size"`
 }
 
-func stat(ctx context.Context, request statRequest) (Stat, error) {
-	stat, err := os.Stat(request.Filename)
-	if err != nil {
-		return Stat{}, err
-	}
+func stat(ctx context.Context, tables *tables, request statRequest) (Stat, error) {
+	var response Stat
 
-	return Stat{
-		Size: stat.Size() / pairSize,
-	}, nil
+	err := tables.view(request.Filename, func(pairs []Pair) error {
+		response.Size = int64(len(pairs))
+		return nil
+	})
+
+	return response, err
 }
@@ -0,0 +1,261 @@
+package index
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/indigowar/dmq/internal/partition/files"
+)
+
+// table is an index file loaded in memory.
+// Index of the active log is kept in a growable slice and every insert is mirrored to the file,
+// index of a closed log is memory-mapped read-only.
+type table struct {
+	mutex   sync.RWMutex
+	pairs   []Pair
+	mapping []byte
+	active  bool
+	closed  bool
+
+	// element is the table's place among mapped tables, it is nil for an active table.
+	element *list.Element
+}
+
+// view calls fn with the pairs of the table, pairs must not be retained after fn returns.
+func (t *table) view(fn func(pairs []Pair) error) error {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if t.closed {
+		return errTableIsClosed
+	}
+
+	return fn(t.pairs)
+}
+
+func (t *table) release() error {
+	t.closed = true
+	t.pairs = nil
+
+	if t.mapping == nil {
+		return nil
+	}
+
+	err := munmap(t.mapping)
+	t.mapping = nil
+	return err
+}
+
+var errTableIsClosed = errors.New("index table is closed")
+
+// maxMappedTables is the amount of sealed tables, which are mapped at once,
+// the least recently used are unmapped and mapped again on the next read.
+const maxMappedTables = 1024
+
+// tables holds loaded index files by their names.
+type tables struct {
+	mutex  sync.Mutex
+	files  *files.Cache
+	loaded map[string]*table
+	// mapped holds names of sealed tables, the most recently used first.
+	mapped *list.List
+}
+
+// get returns a table of the file, the file is mapped if it is not loaded yet.
+func (t *tables) get(filename string) (*table, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if table, ok := t.loaded[filename]; ok {
+		if table.element != nil {
+			t.mapped.MoveToFront(table.element)
+		}
+		return table, nil
+	}
+
+	return t.mapTable(filename)
+}
+
+// mapTable maps the sealed file and unmaps the least recently used tables over the limit.
+func (t *tables) mapTable(filename string) (*table, error) {
+	table, err := mapTable(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	table.element = t.mapped.PushFront(filename)
+	t.loaded[filename] = table
+
+	var errs []error
+	for t.mapped.Len() > maxMappedTables {
+		errs = append(errs, t.release(t.mapped.Back().Value.(string)))
+	}
+
+	return table, errors.Join(errs...)
+}
+
+// release unmaps the loaded table of the file, readers of the table retry with a new one.
+func (t *tables) release(filename string) error {
+	table, ok := t.loaded[filename]
+	if !ok {
+		return nil
+	}
+
+	table.mutex.Lock()
+	err := table.release()
+	table.mutex.Unlock()
+
+	delete(t.loaded, filename)
+	if table.element != nil {
+		t.mapped.Remove(table.element)
+	}
+
+	return err
+}
+
+// view calls fn with the pairs of the file, it retries when the table is replaced meanwhile.
+func (t *tables) view(filename string, fn func(pairs []Pair) error) error {
+	for {
+		table, err := t.get(filename)
+		if err != nil {
+			return err
+		}
+
+		if err := table.view(fn); err != errTableIsClosed {
+			return err
+		}
+	}
+}
+
+// active returns a table of the file, that can be inserted into.
+func (t *tables) active(filename string) (*table, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if table, ok := t.loaded[filename]; ok && table.active {
+		return table, nil
+	}
+
+	if err := t.release(filename); err != nil {
+		return nil, err
+	}
+
+	table, err := loadTable(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	t.loaded[filename] = table
+	return table, nil
+}
+
+// seal replaces the in-memory table of the file with a read-only mapping.
+func (t *tables) seal(filename string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.release(filename); err != nil {
+		return err
+	}
+
+	_, err := t.mapTable(filename)
+	return err
+}
+
+// remove releases the table of the file and deletes it.
+func (t *tables) remove(filename string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return errors.Join(t.release(filename), t.files.Remove(filename))
+}
+
+func mapTable(filename string) (*table, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := stat.Size() - stat.Size()%pairSize
+	if size == 0 {
+		return &table{}, nil
+	}
+
+	mapping, err := mmap(file, int(size))
+	if err != nil {
+		return nil, err
+	}
+
+	return &table{
+		pairs:   asPairs(mapping),
+		mapping: mapping,
+	}, nil
+}
+
+// loadTable reads the file into memory, a partially written pair at the end is cut off,
+// so the next insert does not follow it.
+func loadTable(filename string) (*table, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if stat.Size()%pairSize != 0 {
+		if err := file.Truncate(stat.Size() - stat.Size()%pairSize); err != nil {
+			return nil, err
+		}
+	}
+
+	pairs := make([]Pair, stat.Size()/pairSize)
+	if len(pairs) != 0 {
+		if _, err := io.ReadFull(file, asBytes(pairs)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &table{
+		pairs:  pairs,
+		active: true,
+	}, nil
+}
+
+// asPairs reinterprets the file's content as pairs, it is stored in native endian.
+func asPairs(data []byte) []Pair {
+	return unsafe.Slice((*Pair)(unsafe.Pointer(unsafe.SliceData(data))), len(data)/pairSize)
+}
+
+func asBytes(pairs []Pair) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(pairs))), len(pairs)*pairSize)
+}
+
+func pairToBinary(pair Pair) []byte {
+	data := make([]byte, pairSize)
+	binary.NativeEndian.PutUint64(data[:8], uint64(pair.Key))
+	binary.NativeEndian.PutUint64(data[8:], uint64(pair.Value))
+	return data
+}
+
+func newTables(files *files.Cache) *tables {
+	return &tables{
+		files:  files,
+		loaded: make(map[string]*table),
+		mapped: list.New(),
+	}
+}
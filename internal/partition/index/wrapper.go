@@ -4,17 +4,24 @@ import (
 	"context"
 
 	"github.com/indigowar/dmq/internal/core/communication"
+	"github.com/indigowar/dmq/internal/partition/files"
 )
 
 type Index struct {
-	find   chan<- communication.Request[findRequest, findResponse]
-	insert chan<- communication.Request[insertRequest, noResponse]
-	latest chan<- communication.Request[latestRequest, Pair]
-	stat   chan<- communication.Request[statRequest, Stat]
+	find       *communication.Pool[findRequest, findResponse]
+	insert     *communication.Pool[insertRequest, noResponse]
+	latest     *communication.Pool[latestRequest, Pair]
+	ceiling    *communication.Pool[ceilingRequest, Pair]
+	floor      *communication.Pool[floorRequest, Pair]
+	floorValue *communication.Pool[floorValueRequest, Pair]
+	stat       *communication.Pool[statRequest, Stat]
+	seal       *communication.Pool[sealRequest, noResponse]
+	remove     *communication.Pool[removeRequest, noResponse]
+	removeLast *communication.Pool[removeLastRequest, noResponse]
 }
 
 func (idx Index) Find(ctx context.Context, filename string, key int64) (int64, error) {
-	res, err := communication.Sync(ctx, idx.find, findRequest{
+	res, err := communication.Sync(ctx, idx.find.Requests(), findRequest{
 		Filename: filename,
 		Key:      key,
 	})
@@ -27,7 +34,7 @@ func (idx Index) Find(ctx context.Context, filename string, key int64) (int64, e
 }
 
 func (idx Index) Insert(ctx context.Context, filename string, data Pair) error {
-	_, err := communication.Sync(ctx, idx.insert, insertRequest{
+	_, err := communication.Sync(ctx, idx.insert.Requests(), insertRequest{
 		Filename: filename,
 		Data:     data,
 	})
@@ -35,19 +42,88 @@ func (idx Index) Insert(ctx context.Context, filename string, data Pair) error {
 }
 
 func (idx Index) Latest(ctx context.Context, filename string) (Pair, error) {
-	return communication.Sync(ctx, idx.latest, latestRequest{Filename: filename})
+	return communication.Sync(ctx, idx.latest.Requests(), latestRequest{Filename: filename})
+}
+
+// Ceiling returns the first pair with a key equal or greater than the given one.
+func (idx Index) Ceiling(ctx context.Context, filename string, key int64) (Pair, error) {
+	return communication.Sync(ctx, idx.ceiling.Requests(), ceilingRequest{
+		Filename: filename,
+		Key:      key,
+	})
+}
+
+// Floor returns the last pair with a key equal or less than the given one.
+func (idx Index) Floor(ctx context.Context, filename string, key int64) (Pair, error) {
+	return communication.Sync(ctx, idx.floor.Requests(), floorRequest{
+		Filename: filename,
+		Key:      key,
+	})
+}
+
+// FloorValue returns the last pair with a value equal or less than the given one,
+// it is used on indexes, which values are sorted as well as keys.
+func (idx Index) FloorValue(ctx context.Context, filename string, value int64) (Pair, error) {
+	return communication.Sync(ctx, idx.floorValue.Requests(), floorValueRequest{
+		Filename: filename,
+		Value:    value,
+	})
 }
 
 func (idx Index) Stat(ctx context.Context, filename string) (Stat, error) {
-	return communication.Sync(ctx, idx.stat, statRequest{Filename: filename})
+	return communication.Sync(ctx, idx.stat.Requests(), statRequest{Filename: filename})
 }
 
-func InitIndex(ctx context.Context, workersPerOperation int64) Index {
-	return Index{
-		find:   communication.Workers(ctx, find, int(workersPerOperation)),
-		insert: communication.Workers(ctx, Insert, int(workersPerOperation)),
-		latest: communication.Workers(ctx, latest, int(workersPerOperation)),
-		stat:   communication.Workers(ctx, stat, int(workersPerOperation)),
+// RemoveLast reverts the last insert, the last pair has to be equal to data.
+func (idx Index) RemoveLast(ctx context.Context, filename string, data Pair) error {
+	_, err := communication.Sync(ctx, idx.removeLast.Requests(), removeLastRequest{
+		Filename: filename,
+		Data:     data,
+	})
+	return err
+}
+
+// Seal marks the index as closed for inserts, it is memory-mapped read-only from now on.
+func (idx Index) Seal(ctx context.Context, filename string) error {
+	_, err := communication.Sync(ctx, idx.seal.Requests(), sealRequest{Filename: filename})
+	return err
+}
+
+// Remove releases the index from memory and deletes its file.
+func (idx Index) Remove(ctx context.Context, filename string) error {
+	_, err := communication.Sync(ctx, idx.remove.Requests(), removeRequest{Filename: filename})
+	return err
+}
+
+// Workers returns the current amount of workers per operation.
+func (idx Index) Workers() map[string]int {
+	return map[string]int{
+		"find":        idx.find.Size(),
+		"insert":      idx.insert.Size(),
+		"latest":      idx.latest.Size(),
+		"ceiling":     idx.ceiling.Size(),
+		"floor":       idx.floor.Size(),
+		"floor_value": idx.floorValue.Size(),
+		"stat":        idx.stat.Size(),
+		"seal":        idx.seal.Size(),
+		"remove":      idx.remove.Size(),
+		"remove_last": idx.removeLast.Size(),
 	}
+}
 
+func InitIndex(ctx context.Context, workersPerOperation communication.PoolConfig, files *files.Cache) Index {
+	tables := newTables(files)
+
+	return Index{
+		find:       communication.NewPool(ctx, communication.Bind(tables, find), workersPerOperation),
+		insert:     communication.NewPool(ctx, communication.Bind(tables, Insert), workersPerOperation),
+		latest:     communication.NewPool(ctx, communication.Bind(tables, latest), workersPerOperation),
+		ceiling:    communication.NewPool(ctx, communication.Bind(tables, ceiling), workersPerOperation),
+		floor:      communication.NewPool(ctx, communication.Bind(tables, floor), workersPerOperation),
+		floorValue: communication.NewPool(ctx, communication.Bind(tables, floorValue), workersPerOperation),
+		stat:       communication.NewPool(ctx, communication.Bind(tables, stat), workersPerOperation),
+		seal:       communication.NewPool(ctx, communication.Bind(tables, seal), workersPerOperation),
+		remove:     communication.NewPool(ctx, communication.Bind(tables, remove), workersPerOperation),
+		removeLast: communication.NewPool(ctx, communication.Bind(tables, removeLast), workersPerOperation),
+	}
 }
@@ -0,0 +1,71 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/partition/log"
+)
+
+var (
+	ErrRecordTooLarge = errors.New("record is too large")
+	ErrBatchTooLarge  = log.ErrBatchTooLarge
+)
+
+// Limits restricts sizes of records written into a partition, zero disables a limit.
+// MaxBatchSize is zero by default, then the maximum entry size of the log is used.
+type Limits struct {
+	MaxKeySize    int64 `json:"max_key_size"`
+	MaxValueSize  int64 `json:"max_value_size"`
+	MaxRecordSize int64 `json:"max_record_size"`
+
+	// MaxBatchRecords and MaxBatchSize are applied to a single write request.
+	MaxBatchRecords int64 `json:"max_batch_records"`
+	MaxBatchSize    int64 `json:"max_batch_size"`
+}
+
+// check validates payloads of a write request.
+func (l Limits) check(payloads []record.RecordCreationPayload) error {
+	if exceeds(int64(len(payloads)), l.MaxBatchRecords) {
+		return fmt.Errorf("%w: %d records exceed %d", ErrBatchTooLarge, len(payloads), l.MaxBatchRecords)
+	}
+
+	total := int64(0)
+	for _, payload := range payloads {
+		if exceeds(int64(len(payload.Key)), l.MaxKeySize) {
+			return fmt.Errorf("%w: key size %d exceeds %d", ErrRecordTooLarge, len(payload.Key), l.MaxKeySize)
+		}
+
+		if exceeds(int64(len(payload.Value)), l.MaxValueSize) {
+			return fmt.Errorf("%w: value size %d exceeds %d", ErrRecordTooLarge, len(payload.Value), l.MaxValueSize)
+		}
+
+		size := payloadSize(payload)
+		if exceeds(size, l.MaxRecordSize) {
+			return fmt.Errorf("%w: record size %d exceeds %d", ErrRecordTooLarge, size, l.MaxRecordSize)
+		}
+
+		total += size
+	}
+
+	if exceeds(total, l.MaxBatchSize) {
+		return fmt.Errorf("%w: size %d exceeds %d", ErrBatchTooLarge, total, l.MaxBatchSize)
+	}
+
+	return nil
+}
+
+func exceeds(size int64, limit int64) bool {
+	return limit > 0 && size > limit
+}
+
+// payloadSize is the size of the record's data: key, value and headers.
+func payloadSize(payload record.RecordCreationPayload) int64 {
+	size := int64(len(payload.Key) + len(payload.Value))
+	for _, h := range payload.Headers {
+		size += int64(len(h.Key) + len(h.Value))
+	}
+
+	return size
+}
@@ -0,0 +1,182 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/indigowar/dmq/internal/core/record"
+)
+
+// A log consists of entries, each is prefixed with an int64 size.
+// A positive size is a single record, written before batches were introduced,
+// a negative size is a batch of -size bytes:
+//
+//	magic          uint8  (version of the record format)
+//	crc            uint32 (castagnoli, of everything below)
+//	codec          uint8
+//	base offset    int64
+//	base timestamp int64
+//	max timestamp  int64
+//	count          int32
+//	records        compressed, each is prefixed with an uvarint size
+
+var (
+	ErrCorruptedBatch = &CorruptionError{Field: "batch", Reason: "checksum mismatch"}
+	ErrEmptyBatch     = errors.New("batch is empty")
+	ErrUnknownFormat  = errors.New("unknown record format")
+	ErrBatchTooLarge  = errors.New("batch is too large")
+)
+
+// Format is an encoding of records inside a batch.
+type Format string
+
+const (
+	// FixedFormat stores every field of a record as an int64.
+	FixedFormat Format = "fixed"
+	// CompactFormat stores zig-zag varints, offset and timestamp are deltas from the batch's base.
+	CompactFormat Format = "compact"
+)
+
+// Encoding describes how a batch is written.
+type Encoding struct {
+	Codec  Codec  `json:"codec"`
+	Format Format `json:"format"`
+}
+
+const (
+	fixedBatchMagic   = 1
+	compactBatchMagic = 2
+
+	// batchHeaderSize is the size of the batch fields before records.
+	batchHeaderSize = 1 + 4 + 1 + 8 + 8 + 8 + 4
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func (f Format) magic() (uint8, error) {
+	switch f {
+	case "", FixedFormat:
+		return fixedBatchMagic, nil
+	case CompactFormat:
+		return compactBatchMagic, nil
+	default:
+		return 0, ErrUnknownFormat
+	}
+}
+
+// batchToBinary encodes the batch, records must not exceed maxSize before compression.
+func batchToBinary(records []record.Record, encoding Encoding, maxSize int64) ([]byte, error) {
+	if len(records) == 0 {
+		return nil, ErrEmptyBatch
+	}
+
+	magic, err := encoding.Format.magic()
+	if err != nil {
+		return nil, err
+	}
+
+	codecID, err := encoding.Codec.id()
+	if err != nil {
+		return nil, err
+	}
+
+	baseOffset := records[0].Offset
+	baseTimestamp := records[0].Timestamp.UnixNano()
+	maxTimestamp := baseTimestamp
+
+	var payload []byte
+	for _, r := range records {
+		var data []byte
+		if magic == compactBatchMagic {
+			data = compactRecordToBinary(r, baseOffset, baseTimestamp)
+		} else if data, err = recordToBinary(r); err != nil {
+			return nil, err
+		}
+
+		payload = binary.AppendUvarint(payload, uint64(len(data)))
+		payload = append(payload, data...)
+
+		maxTimestamp = max(maxTimestamp, r.Timestamp.UnixNano())
+	}
+
+	if int64(len(payload)) > maxSize {
+		return nil, fmt.Errorf("%w: records size %d exceeds %d", ErrBatchTooLarge, len(payload), maxSize)
+	}
+
+	compressed, err := encoding.Codec.compress(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, batchHeaderSize+len(compressed))
+	data = append(data, magic)
+	data = binary.LittleEndian.AppendUint32(data, 0) // crc is set below
+	data = append(data, codecID)
+	data = binary.LittleEndian.AppendUint64(data, uint64(baseOffset))
+	data = binary.LittleEndian.AppendUint64(data, uint64(baseTimestamp))
+	data = binary.LittleEndian.AppendUint64(data, uint64(maxTimestamp))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(records)))
+	data = append(data, compressed...)
+
+	binary.LittleEndian.PutUint32(data[1:5], crc32.Checksum(data[5:], crcTable))
+
+	return data, nil
+}
+
+// batchFromBinary decodes the batch, decompressed records must not exceed maxSize.
+func batchFromBinary(data []byte, maxSize int64) ([]record.Record, error) {
+	if len(data) < batchHeaderSize {
+		return nil, corrupted("batch header", "is truncated")
+	}
+
+	magic := data[0]
+	if magic != fixedBatchMagic && magic != compactBatchMagic {
+		return nil, corrupted("batch magic", "%d is unknown", magic)
+	}
+
+	if binary.LittleEndian.Uint32(data[1:5]) != crc32.Checksum(data[5:], crcTable) {
+		return nil, ErrCorruptedBatch
+	}
+
+	codec, err := codecFromID(data[5])
+	if err != nil {
+		return nil, err
+	}
+
+	baseOffset := int64(binary.LittleEndian.Uint64(data[6:14]))
+	baseTimestamp := int64(binary.LittleEndian.Uint64(data[14:22]))
+	count := int64(binary.LittleEndian.Uint32(data[30:34]))
+
+	payload, err := codec.decompress(data[batchHeaderSize:], maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	d := decoder{data: payload}
+
+	// every record takes at least one byte of its size.
+	n := d.count("records", count, 1)
+	records := make([]record.Record, 0, n)
+	for i := 0; i != n; i++ {
+		encoded := d.bytes("record", int64(d.uvarint("record size")))
+		if d.err != nil {
+			return nil, d.err
+		}
+
+		var r record.Record
+		if magic == compactBatchMagic {
+			r, err = compactRecordFromBinary(encoded, baseOffset, baseTimestamp)
+		} else {
+			r, err = recordFromBinary(encoded)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, r)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,126 @@
+package log
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+)
+
+var (
+	ErrUnknownCodec = errors.New("unknown compression codec")
+)
+
+// Codec is a compression algorithm for records of a batch.
+type Codec string
+
+const (
+	NoCompression Codec = "none"
+	Gzip          Codec = "gzip"
+	Flate         Codec = "flate"
+	Zlib          Codec = "zlib"
+	Snappy        Codec = "snappy"
+)
+
+// codecs maps codecs to their identifiers in the batch header, the order must not change.
+var codecs = []Codec{NoCompression, Gzip, Flate, Zlib, Snappy}
+
+func (c Codec) id() (uint8, error) {
+	if c == "" {
+		return 0, nil
+	}
+
+	for i, codec := range codecs {
+		if codec == c {
+			return uint8(i), nil
+		}
+	}
+
+	return 0, ErrUnknownCodec
+}
+
+func codecFromID(id uint8) (Codec, error) {
+	if int(id) >= len(codecs) {
+		return "", corrupted("batch codec", "%d is unknown", id)
+	}
+
+	return codecs[id], nil
+}
+
+func (c Codec) compress(data []byte) ([]byte, error) {
+	var (
+		buffer bytes.Buffer
+		writer io.WriteCloser
+		err    error
+	)
+
+	switch c {
+	case "", NoCompression:
+		return data, nil
+	case Snappy:
+		return snappyEncode(data), nil
+	case Gzip:
+		writer = gzip.NewWriter(&buffer)
+	case Flate:
+		writer, err = flate.NewWriter(&buffer, flate.DefaultCompression)
+	case Zlib:
+		writer = zlib.NewWriter(&buffer)
+	default:
+		return nil, ErrUnknownCodec
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// decompress fails, when the decompressed data is bigger than limit.
+func (c Codec) decompress(data []byte, limit int64) ([]byte, error) {
+	var (
+		reader io.ReadCloser
+		err    error
+	)
+
+	switch c {
+	case "", NoCompression:
+		return data, nil
+	case Snappy:
+		return snappyDecode(data, limit)
+	case Gzip:
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	case Flate:
+		reader = flate.NewReader(bytes.NewReader(data))
+	case Zlib:
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return nil, corrupted("batch codec", "%q is unknown", c)
+	}
+
+	if err != nil {
+		return nil, corrupted("compressed records", "can not be decompressed: %s", err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, corrupted("compressed records", "can not be decompressed: %s", err)
+	}
+
+	if int64(len(decompressed)) > limit {
+		return nil, corrupted("compressed records", "exceed the maximum size %d", limit)
+	}
+
+	return decompressed, nil
+}
@@ -0,0 +1,126 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrCorrupted = errors.New("log is corrupted")
+)
+
+// DefaultMaxEntrySize is used, when the maximum size of a log entry is not configured.
+const DefaultMaxEntrySize = 64 << 20
+
+// CorruptionError is returned, when data read from a log is malformed.
+type CorruptionError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("%s: %s %s", ErrCorrupted, e.Field, e.Reason)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return ErrCorrupted
+}
+
+func corrupted(field string, reason string, args ...any) error {
+	return &CorruptionError{Field: field, Reason: fmt.Sprintf(reason, args...)}
+}
+
+// decoder reads fields from the data, every size is checked against the remaining bytes.
+// After the first failure all reads return zero values, the failure is kept in err.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) remaining() int {
+	return len(d.data)
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	d.data = nil
+}
+
+func (d *decoder) int64(field string) int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	if len(d.data) < 8 {
+		d.fail(corrupted(field, "is truncated"))
+		return 0
+	}
+
+	v := int64(endian.Uint64(d.data))
+	d.data = d.data[8:]
+	return v
+}
+
+func (d *decoder) varint(field string) int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail(corrupted(field, "is not a valid varint"))
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) uvarint(field string) uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail(corrupted(field, "is not a valid uvarint"))
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return v
+}
+
+// count checks, that the amount of items fits into the remaining data, if each takes at least minSize bytes.
+func (d *decoder) count(field string, count int64, minSize int) int {
+	if d.err != nil {
+		return 0
+	}
+
+	if count < 0 || count > int64(len(d.data)/minSize) {
+		d.fail(corrupted(field, "count %d is out of range [0, %d]", count, len(d.data)/minSize))
+		return 0
+	}
+
+	return int(count)
+}
+
+// bytes returns a copy of the next size bytes.
+func (d *decoder) bytes(field string, size int64) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if size < 0 || size > int64(len(d.data)) {
+		d.fail(corrupted(field, "size %d is out of range [0, %d]", size, len(d.data)))
+		return nil
+	}
+
+	v := make([]byte, size)
+	copy(v, d.data)
+	d.data = d.data[size:]
+	return v
+}
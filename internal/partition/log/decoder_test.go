@@ -0,0 +1,134 @@
+package log
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/indigowar/dmq/internal/core/record"
+)
+
+// fuzzLimit is the maximum size of decompressed records in fuzz targets.
+const fuzzLimit = 1 << 16
+
+// allocationOverhead covers fixed allocations of decoders, for example windows of the compression readers.
+const allocationOverhead = 1 << 20
+
+var seedRecords = []record.Record{
+	{Offset: 10, Timestamp: time.Unix(0, 1000), Value: []byte("value")},
+	{Offset: 11, Timestamp: time.Unix(0, 900), Key: []byte("key"), Value: []byte("another value")},
+	{
+		Offset:    12,
+		Timestamp: time.Unix(0, 2000),
+		Key:       []byte("key"),
+		Value:     []byte("value with headers"),
+		Headers:   []record.Header{{Key: "a", Value: []byte("1")}, {Key: "b"}},
+		ExpiresAt: time.Unix(0, 5000),
+	},
+}
+
+// allocated returns the amount of bytes allocated by the call.
+func allocated(call func()) uint64 {
+	var before, after runtime.MemStats
+
+	runtime.ReadMemStats(&before)
+	call()
+	runtime.ReadMemStats(&after)
+
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func checkAllocated(t *testing.T, bytes uint64, limit int) {
+	t.Helper()
+
+	if bytes > uint64(limit) {
+		t.Fatalf("allocated %d bytes, the limit is %d", bytes, limit)
+	}
+}
+
+// checkError fails, when the decoder has failed without reporting a corruption.
+func checkError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil && !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("decoding failed with an error, which is not a corruption: %v", err)
+	}
+}
+
+func FuzzRecordFromBinary(f *testing.F) {
+	for _, r := range seedRecords {
+		data, err := recordToBinary(r)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var err error
+		bytes := allocated(func() { _, err = recordFromBinary(data) })
+
+		checkError(t, err)
+		checkAllocated(t, bytes, allocationOverhead+64*len(data))
+	})
+}
+
+func FuzzCompactRecordFromBinary(f *testing.F) {
+	for _, r := range seedRecords {
+		f.Add(compactRecordToBinary(r, 10, 1000))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var err error
+		bytes := allocated(func() { _, err = compactRecordFromBinary(data, 10, 1000) })
+
+		checkError(t, err)
+		checkAllocated(t, bytes, allocationOverhead+64*len(data))
+	})
+}
+
+func FuzzBatchFromBinary(f *testing.F) {
+	for _, codec := range codecs {
+		for _, format := range []Format{FixedFormat, CompactFormat} {
+			data, err := batchToBinary(seedRecords, Encoding{Codec: codec, Format: format}, fuzzLimit)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(data)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var err error
+		bytes := allocated(func() { _, err = batchFromBinary(data, fuzzLimit) })
+
+		checkError(t, err)
+
+		// every decoded record takes at least one byte of the decompressed data.
+		size := int(unsafe.Sizeof(record.Record{})) * (fuzzLimit + len(data))
+		checkAllocated(t, bytes, allocationOverhead+4*(fuzzLimit+len(data))+size)
+	})
+}
+
+func FuzzSnappyDecode(f *testing.F) {
+	f.Add(snappyEncode([]byte("")))
+	f.Add(snappyEncode([]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")))
+	f.Add(snappyEncode([]byte("snappy snappy snappy, a literal, then copies of snappy")))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var (
+			decoded []byte
+			err     error
+		)
+		bytes := allocated(func() { decoded, err = snappyDecode(data, fuzzLimit) })
+
+		checkError(t, err)
+		if len(decoded) > fuzzLimit {
+			t.Fatalf("decoded %d bytes, the limit is %d", len(decoded), fuzzLimit)
+		}
+
+		checkAllocated(t, bytes, allocationOverhead+fuzzLimit+len(data))
+	})
+}
@@ -42,43 +42,114 @@ func recordToBinary(record record.Record) ([]byte, error) {
 		return nil, err
 	}
 
+	// headers and the expiry are optional and written after the value,
+	// so records without them have the same layout as before they were introduced.
+	if len(record.Headers) > 0 || !record.ExpiresAt.IsZero() {
+		buffer.Write(binary.AppendUvarint(nil, uint64(len(record.Headers))))
+
+		for _, h := range record.Headers {
+			buffer.Write(binary.AppendUvarint(nil, uint64(len(h.Key))))
+			buffer.WriteString(h.Key)
+			buffer.Write(binary.AppendUvarint(nil, uint64(len(h.Value))))
+			buffer.Write(h.Value)
+		}
+	}
+
+	if !record.ExpiresAt.IsZero() {
+		buffer.Write(binary.AppendVarint(nil, record.ExpiresAt.UnixNano()))
+	}
+
 	return buffer.Bytes(), nil
 }
 
 func recordFromBinary(data []byte) (record.Record, error) {
-	buf := bytes.NewReader(data)
+	d := decoder{data: data}
 	r := record.Record{}
 
-	if err := binary.Read(buf, endian, &r.Offset); err != nil {
-		return record.Record{}, err
+	r.Offset = d.int64("offset")
+	r.Timestamp = time.Unix(0, d.int64("timestamp"))
+
+	if key := d.bytes("key", d.int64("key size")); len(key) > 0 {
+		r.Key = key
 	}
 
-	var timestamp int64
-	if err := binary.Read(buf, endian, &timestamp); err != nil {
-		return record.Record{}, err
+	r.Value = d.bytes("value", d.int64("value size"))
+
+	if d.err == nil && d.remaining() > 0 {
+		count := d.count("headers", int64(d.uvarint("headers count")), 2)
+		for i := 0; i != count; i++ {
+			key := d.bytes("header key", int64(d.uvarint("header key size")))
+			value := d.bytes("header value", int64(d.uvarint("header value size")))
+			r.Headers = append(r.Headers, record.Header{Key: string(key), Value: value})
+		}
 	}
-	r.Timestamp = time.Unix(0, timestamp)
 
-	var keyLen int64
-	if err := binary.Read(buf, endian, &keyLen); err != nil {
-		return record.Record{}, err
+	if d.err == nil && d.remaining() > 0 {
+		r.ExpiresAt = time.Unix(0, d.varint("expiry"))
 	}
 
-	if keyLen > 0 {
-		r.Key = make([]byte, keyLen)
-		if err := binary.Read(buf, endian, &r.Key); err != nil {
-			return record.Record{}, err
-		}
+	if d.err != nil {
+		return record.Record{}, d.err
+	}
+
+	return r, nil
+}
+
+// compactRecordToBinary encodes the record with zig-zag varints,
+// offset and timestamp are stored as deltas from the batch's base, the optional expiry is a delta from the timestamp.
+func compactRecordToBinary(r record.Record, baseOffset int64, baseTimestamp int64) []byte {
+	data := make([]byte, 0, len(r.Key)+len(r.Value)+16)
+
+	data = binary.AppendVarint(data, r.Offset-baseOffset)
+	data = binary.AppendVarint(data, r.Timestamp.UnixNano()-baseTimestamp)
+
+	data = binary.AppendVarint(data, int64(len(r.Key)))
+	data = append(data, r.Key...)
+
+	data = binary.AppendVarint(data, int64(len(r.Value)))
+	data = append(data, r.Value...)
+
+	data = binary.AppendVarint(data, int64(len(r.Headers)))
+	for _, h := range r.Headers {
+		data = binary.AppendVarint(data, int64(len(h.Key)))
+		data = append(data, h.Key...)
+		data = binary.AppendVarint(data, int64(len(h.Value)))
+		data = append(data, h.Value...)
+	}
+
+	if !r.ExpiresAt.IsZero() {
+		data = binary.AppendVarint(data, r.ExpiresAt.UnixNano()-r.Timestamp.UnixNano())
+	}
+
+	return data
+}
+
+func compactRecordFromBinary(data []byte, baseOffset int64, baseTimestamp int64) (record.Record, error) {
+	d := decoder{data: data}
+	r := record.Record{}
+
+	r.Offset = baseOffset + d.varint("offset delta")
+	r.Timestamp = time.Unix(0, baseTimestamp+d.varint("timestamp delta"))
+
+	if key := d.bytes("key", d.varint("key size")); len(key) > 0 {
+		r.Key = key
+	}
+
+	r.Value = d.bytes("value", d.varint("value size"))
+
+	count := d.count("headers", d.varint("headers count"), 2)
+	for i := 0; i != count; i++ {
+		key := d.bytes("header key", d.varint("header key size"))
+		value := d.bytes("header value", d.varint("header value size"))
+		r.Headers = append(r.Headers, record.Header{Key: string(key), Value: value})
 	}
 
-	var valueLen int64
-	if err := binary.Read(buf, endian, &valueLen); err != nil {
-		return record.Record{}, err
+	if d.err == nil && d.remaining() > 0 {
+		r.ExpiresAt = time.Unix(0, r.Timestamp.UnixNano()+d.varint("expiry delta"))
 	}
 
-	r.Value = make([]byte, valueLen)
-	if err := binary.Read(buf, endian, &r.Value); err != nil {
-		return record.Record{}, err
+	if d.err != nil {
+		return record.Record{}, d.err
 	}
 
 	return r, nil
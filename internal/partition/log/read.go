@@ -1,44 +1,72 @@
 package log
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
-	"errors"
+	"fmt"
 	"os"
 
 	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/partition/files"
 )
 
 type readRequest struct {
 	Filename string `json:"filename"`
 	Position int64  `json:"position"`
+	MaxSize  int64  `json:"max_size"`
 }
 
-type readResponse = record.Record
+type readResponse = []record.Record
 
-func read(ctx context.Context, request readRequest) (readResponse, error) {
-	file, err := os.OpenFile(request.Filename, os.O_RDONLY, 0644)
+func read(ctx context.Context, files *files.Cache, request readRequest) (readResponse, error) {
+	handle, err := files.Acquire(request.Filename, false)
 	if err != nil {
-		return readResponse{}, errors.New("failed to open the file")
+		return readResponse{}, fmt.Errorf("failed to open the file: %w", err)
 	}
-	defer file.Close()
+	defer handle.Release()
 
+	records, _, err := readAt(handle.File(), request.Position, request.MaxSize)
+	return records, err
+}
+
+// readAt reads records of the entry at the position, it also returns the size that entry takes in the file.
+// Entries bigger than maxSize are treated as corrupted.
+func readAt(file *os.File, position int64, maxSize int64) ([]record.Record, int64, error) {
 	headerBuf := make([]byte, 8) // read an int64
 
-	if _, err := file.ReadAt(headerBuf, request.Position); err != nil {
-		return readResponse{}, err
+	if _, err := file.ReadAt(headerBuf, position); err != nil {
+		return nil, 0, err
+	}
+
+	header := int64(endian.Uint64(headerBuf))
+
+	isBatch := header < 0
+	if isBatch {
+		header = -header
 	}
 
-	var header int64
-	if err := binary.Read(bytes.NewReader(headerBuf), endian, &header); err != nil {
-		return readResponse{}, err
+	// -math.MinInt64 is still negative.
+	if header <= 0 || header > maxSize {
+		return nil, 0, corrupted("entry size", "%d is out of range [1, %d]", header, maxSize)
 	}
 
-	recordBuffer := make([]byte, header)
-	if _, err := file.ReadAt(recordBuffer, request.Position+8); err != nil {
-		return readResponse{}, err
+	buffer := make([]byte, header)
+	if _, err := file.ReadAt(buffer, position+8); err != nil {
+		return nil, 0, err
+	}
+
+	if isBatch {
+		records, err := batchFromBinary(buffer, maxSize)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return records, 8 + header, nil
+	}
+
+	r, err := recordFromBinary(buffer)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return recordFromBinary(recordBuffer)
+	return []record.Record{r}, 8 + header, nil
 }
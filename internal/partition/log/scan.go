@@ -0,0 +1,45 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/indigowar/dmq/internal/core/communication"
+	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/partition/files"
+)
+
+type scanRequest struct {
+	Filename string `json:"filename"`
+	Position int64  `json:"position"`
+	MaxSize  int64  `json:"max_size"`
+}
+
+func scan(ctx context.Context, files *files.Cache, request scanRequest, emitter communication.Emitter[record.Record]) error {
+	handle, err := files.Acquire(request.Filename, false)
+	if err != nil {
+		return fmt.Errorf("failed to open the file: %w", err)
+	}
+	defer handle.Release()
+
+	position := request.Position
+	for {
+		records, size, err := readAt(handle.File(), position, request.MaxSize)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		for _, r := range records {
+			if err := emitter.Emit(ctx, r); err != nil {
+				return err
+			}
+		}
+
+		position += size
+	}
+}
@@ -0,0 +1,178 @@
+package log
+
+import (
+	"encoding/binary"
+)
+
+// A minimal implementation of the snappy block format:
+// an uvarint length of the decoded data followed by literal and copy elements.
+
+var (
+	errSnappyCorrupted = &CorruptionError{Field: "compressed records", Reason: "are not valid snappy"}
+)
+
+const (
+	snappyTagLiteral = 0x00
+	snappyTagCopy2   = 0x02
+	snappyTagCopy4   = 0x03
+
+	snappyTableBits = 14
+	snappyMinMatch  = 4
+)
+
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)+len(src)/6+16), uint64(len(src)))
+
+	var table [1 << snappyTableBits]int32
+	for i := range table {
+		table[i] = -1
+	}
+
+	literal := 0
+	for i := 0; i+snappyMinMatch <= len(src); {
+		sequence := binary.LittleEndian.Uint32(src[i:])
+		hash := (sequence * 0x1e35a7bd) >> (32 - snappyTableBits)
+
+		candidate := int(table[hash])
+		table[hash] = int32(i)
+
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != sequence {
+			i++
+			continue
+		}
+
+		length := snappyMinMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+
+		dst = snappyAppendLiteral(dst, src[literal:i])
+		dst = snappyAppendCopy(dst, i-candidate, length)
+
+		i += length
+		literal = i
+	}
+
+	return snappyAppendLiteral(dst, src[literal:])
+}
+
+func snappyAppendLiteral(dst []byte, literal []byte) []byte {
+	if len(literal) == 0 {
+		return dst
+	}
+
+	n := len(literal) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|snappyTagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|snappyTagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+
+	return append(dst, literal...)
+}
+
+func snappyAppendCopy(dst []byte, offset int, length int) []byte {
+	for length > 0 {
+		// a single copy element holds up to 64 bytes.
+		n := min(length, 64)
+		if length-n > 0 && length-n < snappyMinMatch {
+			n = length - snappyMinMatch
+		}
+
+		if offset < 1<<16 {
+			dst = append(dst, byte(n-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		} else {
+			dst = append(dst, byte(n-1)<<2|snappyTagCopy4, byte(offset), byte(offset>>8), byte(offset>>16), byte(offset>>24))
+		}
+
+		length -= n
+	}
+
+	return dst
+}
+
+func snappyDecode(src []byte, limit int64) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 || size > uint64(limit) || size > uint64(len(src))*255+64 {
+		return nil, errSnappyCorrupted
+	}
+	src = src[n:]
+
+	dst := make([]byte, 0, size)
+	for len(src) > 0 {
+		tag := src[0]
+
+		var length, offset int
+		switch tag & 0x03 {
+		case snappyTagLiteral:
+			length = int(tag >> 2)
+			src = src[1:]
+
+			if length >= 60 {
+				extra := length - 59
+				if len(src) < extra {
+					return nil, errSnappyCorrupted
+				}
+
+				length = 0
+				for i := extra - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			length++
+
+			if length <= 0 || length > len(src) || uint64(len(dst)+length) > size {
+				return nil, errSnappyCorrupted
+			}
+
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case 0x01:
+			if len(src) < 2 {
+				return nil, errSnappyCorrupted
+			}
+			length = 4 + int(tag>>2)&0x07
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case snappyTagCopy2:
+			if len(src) < 3 {
+				return nil, errSnappyCorrupted
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case snappyTagCopy4:
+			if len(src) < 5 {
+				return nil, errSnappyCorrupted
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+length) > size {
+			return nil, errSnappyCorrupted
+		}
+
+		// copies can overlap with themselves, so they are done byte by byte.
+		start := len(dst) - offset
+		for i := 0; i != length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+
+	if uint64(len(dst)) != size {
+		return nil, errSnappyCorrupted
+	}
+
+	return dst, nil
+}
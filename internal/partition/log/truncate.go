@@ -0,0 +1,58 @@
+package log
+
+import (
+	"context"
+
+	"github.com/indigowar/dmq/internal/partition/files"
+)
+
+type truncateRequest struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+}
+
+type truncateResponse = struct{}
+
+func truncate(ctx context.Context, files *files.Cache, request truncateRequest) (truncateResponse, error) {
+	handle, err := files.Acquire(request.Filename, false)
+	if err != nil {
+		return truncateResponse{}, err
+	}
+	defer handle.Release()
+
+	return truncateResponse{}, handle.File().Truncate(request.Size)
+}
+
+type truncateAfterRequest struct {
+	Filename string `json:"filename"`
+	Position int64  `json:"position"`
+	MaxSize  int64  `json:"max_size"`
+}
+
+type truncateAfterResponse = struct{}
+
+// truncateAfter cuts the file after the entry at the position,
+// it drops entries and partially written data, which follow the entry.
+func truncateAfter(ctx context.Context, files *files.Cache, request truncateAfterRequest) (truncateAfterResponse, error) {
+	handle, err := files.Acquire(request.Filename, false)
+	if err != nil {
+		return truncateAfterResponse{}, err
+	}
+	defer handle.Release()
+
+	_, size, err := readAt(handle.File(), request.Position, request.MaxSize)
+	if err != nil {
+		return truncateAfterResponse{}, err
+	}
+
+	stat, err := handle.File().Stat()
+	if err != nil {
+		return truncateAfterResponse{}, err
+	}
+
+	if stat.Size() == request.Position+size {
+		return truncateAfterResponse{}, nil
+	}
+
+	return truncateAfterResponse{}, handle.File().Truncate(request.Position + size)
+}
@@ -5,35 +5,49 @@ import (
 
 	"github.com/indigowar/dmq/internal/core/communication"
 	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/partition/files"
 )
 
 type Log struct {
-	read     chan<- communication.Request[readRequest, readResponse]
-	write    chan<- communication.Request[writeRequest, writeResponse]
-	writeNew chan<- communication.Request[writeInNewFileRequest, writeInNewFileResponse]
+	read     *communication.Pool[readRequest, readResponse]
+	write    *communication.Pool[writeRequest, writeResponse]
+	writeNew *communication.Pool[writeInNewFileRequest, writeInNewFileResponse]
+	scan     *communication.StreamPool[scanRequest, record.Record]
+	truncate *communication.Pool[truncateRequest, truncateResponse]
+
+	truncateAfter *communication.Pool[truncateAfterRequest, truncateAfterResponse]
+
+	maxEntrySize int64
 }
 
-func (log Log) Read(ctx context.Context, filename string, position int64) (record.Record, error) {
-	return communication.Sync(ctx, log.read, readRequest{
+// Read returns records of the batch at the position.
+func (log Log) Read(ctx context.Context, filename string, position int64) ([]record.Record, error) {
+	return communication.Sync(ctx, log.read.Requests(), readRequest{
 		Filename: filename,
 		Position: position,
+		MaxSize:  log.maxEntrySize,
 	})
 }
 
-func (log Log) Write(ctx context.Context, filename string, record record.Record) (int64, error) {
-	result, err := communication.Sync(ctx, log.write, writeRequest{
+// Write appends records as a single batch with the given encoding.
+func (log Log) Write(ctx context.Context, filename string, records []record.Record, encoding Encoding) (int64, error) {
+	result, err := communication.Sync(ctx, log.write.Requests(), writeRequest{
 		Filename: filename,
-		Record:   record,
+		Records:  records,
+		Encoding: encoding,
+		MaxSize:  log.maxEntrySize,
 	})
 
 	return result.PhysicalPosition, err
 }
 
-func (log Log) WriteNew(ctx context.Context, dir string, ext string, record record.Record) (int64, int64, error) {
-	result, err := communication.Sync(ctx, log.writeNew, writeInNewFileRequest{
-		Dir:    dir,
-		Ext:    ext,
-		Record: record,
+func (log Log) WriteNew(ctx context.Context, dir string, ext string, records []record.Record, encoding Encoding) (int64, int64, error) {
+	result, err := communication.Sync(ctx, log.writeNew.Requests(), writeInNewFileRequest{
+		Dir:      dir,
+		Ext:      ext,
+		Records:  records,
+		Encoding: encoding,
+		MaxSize:  log.maxEntrySize,
 	})
 	if err != nil {
 		return 0, 0, err
@@ -42,10 +56,68 @@ func (log Log) WriteNew(ctx context.Context, dir string, ext string, record reco
 	return int64(result.File), result.PhysicalPosition, nil
 }
 
-func InitLog(ctx context.Context, workersPerOperation int) Log {
+// Truncate cuts the file to the size, it is used to revert a write.
+func (log Log) Truncate(ctx context.Context, filename string, size int64) error {
+	_, err := communication.Sync(ctx, log.truncate.Requests(), truncateRequest{
+		Filename: filename,
+		Size:     size,
+	})
+	return err
+}
+
+// TruncateAfter cuts the file after the entry at the position, it is used to drop uncommitted entries on recovery.
+func (log Log) TruncateAfter(ctx context.Context, filename string, position int64) error {
+	_, err := communication.Sync(ctx, log.truncateAfter.Requests(), truncateAfterRequest{
+		Filename: filename,
+		Position: position,
+		MaxSize:  log.maxEntrySize,
+	})
+	return err
+}
+
+// Scan streams records of the file, starting at the position, until the end of the file.
+// buffer is the amount of records, that can be read ahead of the consumer.
+func (log Log) Scan(ctx context.Context, filename string, position int64, buffer int) *communication.Stream[record.Record] {
+	return log.scan.Open(ctx, scanRequest{
+		Filename: filename,
+		Position: position,
+		MaxSize:  log.maxEntrySize,
+	}, buffer)
+}
+
+// MaxEntrySize returns the maximum size of a batch, which can be written and read back.
+func (log Log) MaxEntrySize() int64 {
+	return log.maxEntrySize
+}
+
+// Workers returns the current amount of workers per operation.
+func (log Log) Workers() map[string]int {
+	return map[string]int{
+		"read":      log.read.Size(),
+		"write":     log.write.Size(),
+		"write_new": log.writeNew.Size(),
+		"scan":      log.scan.Size(),
+		"truncate":  log.truncate.Size(),
+
+		"truncate_after": log.truncateAfter.Size(),
+	}
+}
+
+// InitLog starts workers of the log, maxEntrySize limits the size of a record or a batch
+// accepted while writing and reading, zero means DefaultMaxEntrySize.
+func InitLog(ctx context.Context, workersPerOperation communication.PoolConfig, files *files.Cache, maxEntrySize int64) Log {
+	if maxEntrySize <= 0 {
+		maxEntrySize = DefaultMaxEntrySize
+	}
+
 	return Log{
-		read:     communication.Workers(ctx, read, workersPerOperation),
-		write:    communication.Workers(ctx, write, workersPerOperation),
-		writeNew: communication.Workers(ctx, writeNew, workersPerOperation),
+		read:         communication.NewPool(ctx, communication.Bind(files, read), workersPerOperation),
+		write:        communication.NewPool(ctx, communication.Bind(files, write), workersPerOperation),
+		writeNew:     communication.NewPool(ctx, communication.Bind(files, writeNew), workersPerOperation),
+		scan:         communication.NewStreamPool(ctx, communication.BindStream(files, scan), workersPerOperation),
+		truncate:     communication.NewPool(ctx, communication.Bind(files, truncate), workersPerOperation),
+		maxEntrySize: maxEntrySize,
+
+		truncateAfter: communication.NewPool(ctx, communication.Bind(files, truncateAfter), workersPerOperation),
 	}
 }
@@ -9,11 +9,14 @@ import (
 	"os"
 
 	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/partition/files"
 )
 
 type writeRequest struct {
-	Filename string        `json:"filename"`
-	Record   record.Record `json:"record"`
+	Filename string          `json:"filename"`
+	Records  []record.Record `json:"records"`
+	Encoding Encoding        `json:"encoding"`
+	MaxSize  int64           `json:"max_size"`
 }
 
 type writeResponse struct {
@@ -21,9 +24,11 @@ type writeResponse struct {
 }
 
 type writeInNewFileRequest struct {
-	Dir    string        `json:"dir"`
-	Ext    string        `json:"ext"`
-	Record record.Record `json:"record"`
+	Dir      string          `json:"dir"`
+	Ext      string          `json:"ext"`
+	Records  []record.Record `json:"records"`
+	Encoding Encoding        `json:"encoding"`
+	MaxSize  int64           `json:"max_size"`
 }
 
 type writeInNewFileResponse struct {
@@ -31,20 +36,19 @@ type writeInNewFileResponse struct {
 	PhysicalPosition int64 `json:"physical_position"`
 }
 
-func write(ctx context.Context, request writeRequest) (writeResponse, error) {
-	data, err := encodeRecord(request.Record)
+func write(ctx context.Context, files *files.Cache, request writeRequest) (writeResponse, error) {
+	data, err := encodeBatch(request.Records, request.Encoding, request.MaxSize)
 	if err != nil {
 		return writeResponse{}, err
 	}
 
-	file, err := os.OpenFile(request.Filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	handle, err := files.Acquire(request.Filename, true)
 	if err != nil {
 		return writeResponse{}, err
 	}
+	defer handle.Release()
 
-	defer file.Close()
-
-	pos, err := writeInFile(file, data)
+	pos, err := writeInFile(handle.File(), data)
 	if err != nil {
 		return writeResponse{}, err
 	}
@@ -52,14 +56,14 @@ func write(ctx context.Context, request writeRequest) (writeResponse, error) {
 	return writeResponse{PhysicalPosition: pos}, nil
 }
 
-func writeNew(ctx context.Context, request writeInNewFileRequest) (writeInNewFileResponse, error) {
-	files, err := os.ReadDir(request.Dir)
+func writeNew(ctx context.Context, files *files.Cache, request writeInNewFileRequest) (writeInNewFileResponse, error) {
+	entries, err := os.ReadDir(request.Dir)
 	if err != nil {
 		return writeInNewFileResponse{}, err
 	}
 
 	biggest := 0
-	for _, file := range files {
+	for _, file := range entries {
 		var (
 			number = 0
 			ext    = ""
@@ -80,11 +84,20 @@ func writeNew(ctx context.Context, request writeInNewFileRequest) (writeInNewFil
 		biggest = max(biggest, number)
 	}
 
-	res, err := write(ctx, writeRequest{
-		Filename: fmt.Sprintf("%s/%08d.%s", request.Dir, biggest+1, request.Ext),
-		Record:   request.Record,
+	filename := fmt.Sprintf("%s/%08d.%s", request.Dir, biggest+1, request.Ext)
+
+	res, err := write(ctx, files, writeRequest{
+		Filename: filename,
+		Records:  request.Records,
+		Encoding: request.Encoding,
+		MaxSize:  request.MaxSize,
 	})
 	if err != nil {
+		// an empty log would take the number of the next new log.
+		if removeErr := files.Remove(filename); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+			return writeInNewFileResponse{}, errors.Join(err, removeErr)
+		}
+
 		return writeInNewFileResponse{}, err
 	}
 
@@ -103,25 +116,32 @@ func writeInFile(file *os.File, data []byte) (int64, error) {
 	position := stat.Size()
 
 	if _, err := file.Write(data); err != nil {
-		return 0, err
+		// do not leave a partially written entry behind.
+		return 0, errors.Join(err, file.Truncate(position))
 	}
 
 	return position, nil
 }
 
-func encodeRecord(r record.Record) ([]byte, error) {
-	record, err := recordToBinary(r)
+// encodeBatch encodes records as a batch, prefixed with its negated size.
+// A batch, which can not be read back with the maxSize, is rejected.
+func encodeBatch(records []record.Record, encoding Encoding, maxSize int64) ([]byte, error) {
+	batch, err := batchToBinary(records, encoding, maxSize)
 	if err != nil {
 		return nil, err
 	}
 
+	if int64(len(batch)) > maxSize {
+		return nil, fmt.Errorf("%w: entry size %d exceeds %d", ErrBatchTooLarge, len(batch), maxSize)
+	}
+
 	var buf bytes.Buffer
 
-	if err := binary.Write(&buf, binary.LittleEndian, int64(len(record))); err != nil {
+	if err := binary.Write(&buf, binary.LittleEndian, -int64(len(batch))); err != nil {
 		return nil, err
 	}
 
-	buf.Write(record)
+	buf.Write(batch)
 
 	return buf.Bytes(), nil
 }
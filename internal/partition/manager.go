@@ -2,37 +2,354 @@ package partition
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
 	"sync"
 
+	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/partition/files"
 	"github.com/indigowar/dmq/internal/partition/index"
 	"github.com/indigowar/dmq/internal/partition/log"
 	"github.com/indigowar/dmq/internal/topic"
 )
 
+var (
+	ErrPartitionNotFound = errors.New("partition not found")
+)
+
+// Manager owns partitions, which are stored in subdirectories of its directory.
 type Manager struct {
+	logger *slog.Logger
+
 	mutex      sync.RWMutex
 	partitions []*partition
 
+	path   string
+	config Config
+
 	index index.Index
 	log   log.Log
+	files *files.Cache
 }
 
 func (m *Manager) CreatePartition(ctx context.Context, request topic.NewPartitionRequest) (topic.NewPartitionResponse, error) {
-	panic("unimplemented")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	number := int64(len(m.partitions))
+
+	p, err := newPartition(m.logger, m.partitionPath(number), number, m.config, m.index, m.log, m.files)
+	if err != nil {
+		m.logger.Error("failed to create a partition", "partition", number, "err", err)
+		return topic.NewPartitionResponse{}, err
+	}
+
+	m.partitions = append(m.partitions, p)
+
+	return topic.NewPartitionResponse{Partition: number}, nil
 }
 
 func (m *Manager) Write(ctx context.Context, request topic.WriteIntoPartitionRequest) (topic.WriteIntoPartitionResponse, error) {
-	panic("unimplemented")
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.WriteIntoPartitionResponse{}, err
+	}
+
+	offset, timestamp, err := p.Write(ctx, record.RecordCreationPayload{
+		Key:       request.Key,
+		Value:     request.Value,
+		Headers:   request.Headers,
+		Timestamp: request.Timestamp,
+		ExpiresAt: request.ExpiresAt,
+	})
+	if err != nil {
+		return topic.WriteIntoPartitionResponse{}, err
+	}
+
+	return topic.WriteIntoPartitionResponse{Offset: offset, Timestamp: timestamp}, nil
 }
 
 func (m *Manager) ReadByOffset(ctx context.Context, request topic.ReadByOffsetFromPartitionRequest) (topic.ReadFromPartitionResponse, error) {
-	panic("unimplemented")
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.ReadFromPartitionResponse{}, err
+	}
+
+	r, err := p.ReadByOffset(ctx, request.Offset)
+	if err != nil {
+		return topic.ReadFromPartitionResponse{}, err
+	}
+
+	return toReadResponse(r), nil
+}
+
+func (m *Manager) ReadRange(ctx context.Context, request topic.ReadRangeFromPartitionRequest) (topic.ReadRangeFromPartitionResponse, error) {
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.ReadRangeFromPartitionResponse{}, err
+	}
+
+	records, next, err := p.ReadRange(ctx, request.Offset, request.Count, request.IncludeExpired)
+	if err != nil {
+		return topic.ReadRangeFromPartitionResponse{}, err
+	}
+
+	return topic.ReadRangeFromPartitionResponse{Records: toReadResponses(records), NextOffset: next}, nil
 }
 
 func (m *Manager) ReadByTimestamp(ctx context.Context, request topic.ReadByTimestampFromPartitionRequest) (topic.ReadFromPartitionResponse, error) {
-	panic("unimplemented")
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.ReadFromPartitionResponse{}, err
+	}
+
+	r, err := p.ReadByTimestamp(ctx, request.Timestamp)
+	if err != nil {
+		return topic.ReadFromPartitionResponse{}, err
+	}
+
+	return toReadResponse(r), nil
+}
+
+func (m *Manager) WaitFor(ctx context.Context, request topic.WaitForPartitionRequest) (topic.WaitForPartitionResponse, error) {
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.WaitForPartitionResponse{}, err
+	}
+
+	next, err := p.WaitFor(ctx, request.Offset, request.MinRecords, request.MaxWait)
+	if err != nil {
+		return topic.WaitForPartitionResponse{}, err
+	}
+
+	return topic.WaitForPartitionResponse{
+		NextOffset: next,
+		Available:  max(next-request.Offset, 0),
+	}, nil
+}
+
+func (m *Manager) HighWatermark(ctx context.Context, request topic.HighWatermarkRequest) (topic.HighWatermarkResponse, error) {
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.HighWatermarkResponse{}, err
+	}
+
+	return topic.HighWatermarkResponse{
+		NextOffset:    p.HighWatermark(),
+		HeadTimestamp: p.HeadTimestamp(),
+	}, nil
+}
+
+func (m *Manager) OffsetTimestamp(ctx context.Context, request topic.OffsetTimestampRequest) (topic.OffsetTimestampResponse, error) {
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.OffsetTimestampResponse{}, err
+	}
+
+	timestamp, err := p.OffsetTimestamp(ctx, request.Offset)
+	if err != nil {
+		return topic.OffsetTimestampResponse{}, err
+	}
+
+	return topic.OffsetTimestampResponse{Timestamp: timestamp}, nil
+}
+
+func (m *Manager) LowWatermark(ctx context.Context, request topic.LowWatermarkRequest) (topic.LowWatermarkResponse, error) {
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.LowWatermarkResponse{}, err
+	}
+
+	offset, err := p.LowWatermark(ctx)
+	if err != nil {
+		return topic.LowWatermarkResponse{}, err
+	}
+
+	return topic.LowWatermarkResponse{Offset: offset}, nil
+}
+
+func (m *Manager) Compact(ctx context.Context, request topic.CompactPartitionRequest) (topic.CompactPartitionResponse, error) {
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.CompactPartitionResponse{}, err
+	}
+
+	removed, err := p.Compact(ctx)
+	if err != nil {
+		return topic.CompactPartitionResponse{}, err
+	}
+
+	return topic.CompactPartitionResponse{Removed: removed}, nil
+}
+
+func (m *Manager) DeleteExpiredLogs(ctx context.Context, request topic.DeleteExpiredLogsRequest) (topic.DeleteExpiredLogsResponse, error) {
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.DeleteExpiredLogsResponse{}, err
+	}
+
+	deleted, err := p.DeleteExpiredLogs(ctx)
+	if err != nil {
+		return topic.DeleteExpiredLogsResponse{}, err
+	}
+
+	return topic.DeleteExpiredLogsResponse{Deleted: deleted}, nil
 }
 
-func NewManager() (*Manager, error) {
-	panic("unimplemented")
+func (m *Manager) ReadLatest(ctx context.Context, request topic.ReadLatestFromPartitionRequest) (topic.ReadFromPartitionResponse, error) {
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.ReadFromPartitionResponse{}, err
+	}
+
+	r, err := p.Latest(ctx)
+	if err != nil {
+		return topic.ReadFromPartitionResponse{}, err
+	}
+
+	return toReadResponse(r), nil
+}
+
+func (m *Manager) Tail(ctx context.Context, request topic.TailPartitionRequest) (topic.TailPartitionResponse, error) {
+	p, err := m.get(request.Partition)
+	if err != nil {
+		return topic.TailPartitionResponse{}, err
+	}
+
+	records, err := p.Tail(ctx, request.Count)
+	if err != nil {
+		return topic.TailPartitionResponse{}, err
+	}
+
+	return topic.TailPartitionResponse{Records: toReadResponses(records)}, nil
+}
+
+// Partitions returns numbers of all partitions in ascending order.
+func (m *Manager) Partitions() []int64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	numbers := make([]int64, 0, len(m.partitions))
+	for _, p := range m.partitions {
+		numbers = append(numbers, p.Number)
+	}
+
+	return numbers
+}
+
+// Len returns the amount of partitions.
+func (m *Manager) Len() int64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return int64(len(m.partitions))
+}
+
+// Delete removes all partitions with their files, the manager must not be used after it.
+func (m *Manager) Delete(ctx context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var errs []error
+	for _, p := range m.partitions {
+		errs = append(errs, p.delete(ctx))
+	}
+	m.partitions = nil
+
+	return errors.Join(errs...)
+}
+
+func (m *Manager) get(number int64) (*partition, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, p := range m.partitions {
+		if p.Number == number {
+			return p, nil
+		}
+	}
+
+	return nil, ErrPartitionNotFound
+}
+
+func toReadResponse(r record.Record) topic.ReadFromPartitionResponse {
+	return topic.ReadFromPartitionResponse{
+		Offset:    r.Offset,
+		Timestamp: r.Timestamp,
+		Key:       r.Key,
+		Value:     r.Value,
+		Headers:   r.Headers,
+		ExpiresAt: r.ExpiresAt,
+	}
+}
+
+func toReadResponses(records []record.Record) []topic.ReadFromPartitionResponse {
+	responses := make([]topic.ReadFromPartitionResponse, 0, len(records))
+	for _, r := range records {
+		responses = append(responses, toReadResponse(r))
+	}
+
+	return responses
+}
+
+func (m *Manager) partitionPath(number int64) string {
+	return fmt.Sprintf("%s/%08d", m.path, number)
+}
+
+// NewManager loads partitions from the directory, new partitions are created with the config.
+func NewManager(logger *slog.Logger, path string, config Config, index index.Index, log log.Log, files *files.Cache) (*Manager, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	return openManager(logger, path, config, index, log, files, false)
+}
+
+// NewReadOnlyManager loads partitions from the directory without recovering them,
+// so files of a running broker are not changed. The partitions must not be written into.
+func NewReadOnlyManager(logger *slog.Logger, path string, config Config, index index.Index, log log.Log, files *files.Cache) (*Manager, error) {
+	return openManager(logger, path, config, index, log, files, true)
+}
+
+func openManager(logger *slog.Logger, path string, config Config, index index.Index, log log.Log, files *files.Cache, readOnly bool) (*Manager, error) {
+	m := &Manager{
+		logger: logger,
+		path:   path,
+		config: config,
+		index:  index,
+		log:    log,
+		files:  files,
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		number, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if !entry.IsDir() || err != nil {
+			continue
+		}
+
+		p, err := loadPartition(logger, m.partitionPath(number), number, index, log, files, readOnly)
+		if err != nil {
+			logger.Error("failed to load a partition", "partition", number, "err", err)
+			return nil, err
+		}
+
+		m.partitions = append(m.partitions, p)
+	}
+
+	// partitions are numbered sequentially, so a gap means lost data.
+	for i, p := range m.partitions {
+		if p.Number != int64(i) {
+			return nil, fmt.Errorf("partition %d is missing in %s", i, path)
+		}
+	}
+
+	return m, nil
 }
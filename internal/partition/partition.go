@@ -7,11 +7,16 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/indigowar/dmq/internal/core/communication"
 	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/partition/files"
 	"github.com/indigowar/dmq/internal/partition/index"
 	"github.com/indigowar/dmq/internal/partition/log"
 )
@@ -23,147 +28,593 @@ var (
 	timestampIdxExt = "tdx"
 )
 
+var (
+	ErrPartitionIsEmpty    = errors.New("partition is empty")
+	ErrRecordNotFound      = errors.New("record not found")
+	ErrTimestampOutOfRange = errors.New("timestamp is out of the allowed range")
+	ErrInvalidExpiry       = errors.New("expiry is before the timestamp or out of the supported range")
+	ErrLogsChanged         = errors.New("logs of the partition have changed concurrently")
+	ErrCorruptedPartition  = errors.New("partition has a log without committed records")
+)
+
+// scanBuffer is the amount of records, that are read ahead while scanning a log.
+const scanBuffer = 16
+
+// latestChunk is the amount of records, which Latest reads at once, while it skips expired records.
+const latestChunk = 256
+
+// view is an immutable state of the partition, which is visible to readers.
+// It is published after an append is committed, so readers never see in-flight records.
+type view struct {
+	logs []int64
+	// highWatermark is the offset of the next record, all records before it are committed.
+	highWatermark int64
+	// maxTimestamp is the maximum timestamp of committed records, the same as in the timestamp index.
+	maxTimestamp int64
+}
+
 type partition struct {
 	logger *slog.Logger
 
-	mutex sync.RWMutex
+	// mutex serializes writers, readers use the committed view instead.
+	mutex sync.Mutex
+	view  atomic.Pointer[view]
+	// compacting serializes compactions, they take the mutex only to create and replace logs.
+	compacting sync.Mutex
 
 	index index.Index
 	log   log.Log
+	files *files.Cache
+
+	// appended receives the next offset after every successful write.
+	appended communication.Hub[int64]
 
 	path string
 
-	Number     int64   `json:"number"`
-	Logs       []int64 `json:"logs"`
-	LogSize    int64   `json:"log_size"`
-	NextOffset int64   `json:"next_offset"`
+	Number       int64   `json:"number"`
+	Logs         []int64 `json:"logs"`
+	NextOffset   int64   `json:"next_offset"`
+	MaxTimestamp int64   `json:"max_timestamp"`
+	// CleanedOffset is the offset, before which all records have passed a compaction.
+	CleanedOffset int64 `json:"cleaned_offset"`
+
+	Config
+}
+
+// Config is the configuration of a partition, which is chosen on its creation.
+type Config struct {
+	LogSize int64 `json:"log_size"`
+
+	TimestampType    record.TimestampType `json:"timestamp_type"`
+	MaxTimestampSkew time.Duration        `json:"max_timestamp_skew"`
+
+	Compression  log.Codec  `json:"compression"`
+	RecordFormat log.Format `json:"record_format"`
+
+	Limits Limits `json:"limits"`
+
+	// DeleteRetention is the time, for which tombstones are kept after they have passed a compaction.
+	DeleteRetention time.Duration `json:"delete_retention"`
 }
 
 func (p *partition) Write(ctx context.Context, payload record.RecordCreationPayload) (int64, time.Time, error) {
+	records, err := p.WriteBatch(ctx, []record.RecordCreationPayload{payload})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return records[0].Offset, records[0].Timestamp, nil
+}
+
+// WriteBatch writes payloads as a single batch, it returns the written records.
+func (p *partition) WriteBatch(ctx context.Context, payloads []record.RecordCreationPayload) ([]record.Record, error) {
+	if len(payloads) == 0 {
+		return nil, log.ErrEmptyBatch
+	}
+
+	// limits are checked before any offset is assigned.
+	limits := p.Limits
+	if limits.MaxBatchSize <= 0 {
+		limits.MaxBatchSize = p.log.MaxEntrySize()
+	}
+
+	if err := limits.check(payloads); err != nil {
+		p.logger.Warn("rejected a batch", "partition", p.Number, "err", err)
+		return nil, err
+	}
+
+	records, err := p.append(ctx, payloads)
+	if err != nil {
+		return nil, err
+	}
+
+	next := records[len(records)-1].Offset + 1
+	if err := p.appended.Publish(ctx, next); err != nil {
+		p.logger.Warn("failed to notify about new records", "partition", p.Number, "offset", next, "err", err)
+	}
+
+	return records, nil
+}
+
+// Subscribe returns a subscription, that receives the next offset after every write.
+// Only the latest offset is kept, when the subscriber falls behind.
+func (p *partition) Subscribe(buffer int) (*communication.Subscription[int64], error) {
+	return p.appended.Subscribe(buffer, communication.DropOldest)
+}
+
+// WaitFor blocks until at least minRecords records at or beyond the offset are written,
+// or maxWait is elapsed (maxWait <= 0 waits until ctx is done). It returns the next offset of the partition.
+func (p *partition) WaitFor(ctx context.Context, offset int64, minRecords int64, maxWait time.Duration) (int64, error) {
+	minRecords = max(minRecords, 1)
+
+	// subscribe before reading the offset, so no write in between is missed.
+	subscription, err := p.Subscribe(1)
+	if err != nil {
+		return 0, err
+	}
+	defer subscription.Unsubscribe()
+
+	next := p.nextOffset()
+	if next-offset >= minRecords {
+		return next, nil
+	}
+
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+
+		timeout = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, communication.ErrOperationIsCancelled
+		case <-timeout:
+			return p.nextOffset(), nil
+		case n, ok := <-subscription.C():
+			if !ok {
+				return p.nextOffset(), nil
+			}
+
+			if n-offset >= minRecords {
+				return n, nil
+			}
+		}
+	}
+}
+
+func (p *partition) nextOffset() int64 {
+	return p.snapshot().highWatermark
+}
+
+// snapshot returns the latest committed view.
+func (p *partition) snapshot() view {
+	if v := p.view.Load(); v != nil {
+		return *v
+	}
+
+	return view{}
+}
+
+// publish makes the current state visible to readers, it must be called by a writer.
+func (p *partition) publish() {
+	p.view.Store(&view{
+		logs:          append([]int64(nil), p.Logs...),
+		highWatermark: p.NextOffset,
+		maxTimestamp:  p.MaxTimestamp,
+	})
+}
+
+// append writes records as a single batch, either completely or not at all:
+// when any step fails, the written data is reverted and the offsets are not consumed.
+func (p *partition) append(ctx context.Context, payloads []record.RecordCreationPayload) ([]record.Record, error) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	defer p.dump()
 
-	record := record.Record{
-		Offset:    p.NextOffset,
-		Timestamp: time.Now(),
-		Key:       payload.Key,
-		Value:     payload.Value,
+	// a cancelled write may still be done by a worker, so the ctx is checked only before the first one:
+	// reverting a write, which is still in progress, could leave data of uncommitted offsets behind.
+	if ctx.Err() != nil {
+		return nil, communication.ErrOperationIsCancelled
 	}
+	ctx = context.WithoutCancel(ctx)
 
-	p.logger.Info("creating a new record", "partition", p.Number, "offset", record.Offset, "timestamp", record.Timestamp)
+	records := make([]record.Record, 0, len(payloads))
+	for i, payload := range payloads {
+		timestamp, err := p.timestamp(payload.Timestamp)
+		if err != nil {
+			p.logger.Warn("rejected a record", "partition", p.Number, "timestamp", payload.Timestamp, "err", err)
+			return nil, err
+		}
 
-	p.NextOffset++
+		if !validExpiry(payload.ExpiresAt, timestamp) {
+			p.logger.Warn("rejected a record", "partition", p.Number, "expires_at", payload.ExpiresAt, "err", ErrInvalidExpiry)
+			return nil, ErrInvalidExpiry
+		}
+
+		records = append(records, record.Record{
+			Offset:    p.NextOffset + int64(i),
+			Timestamp: timestamp,
+			Key:       payload.Key,
+			Value:     payload.Value,
+			Headers:   payload.Headers,
+			ExpiresAt: payload.ExpiresAt,
+		})
+	}
+
+	p.logger.Info("creating a new batch", "partition", p.Number, "offset", records[0].Offset, "count", len(records))
 
 	if len(p.Logs) == 0 {
 		p.logger.Info("creating a new log", "reason", "partition is empty")
-		return record.Offset, record.Timestamp, p.writeNew(ctx, record)
+		return records, p.writeNew(ctx, records)
 	}
 
 	number := p.Logs[len(p.Logs)-1]
-	stat, err := p.index.Stat(ctx, p.offsetIndexPath(number))
+	first, err := p.firstOffset(ctx, number)
 	if err != nil {
-		p.logger.Error("failed to get index's stat", "log", number, "err", err)
-		return 0, time.Time{}, err
+		return nil, err
 	}
 
-	if stat.Size == p.LogSize {
+	if p.LogSize > 0 && records[0].Offset-first >= p.LogSize {
 		p.logger.Info("creating a new log", "reason", "last log is full")
-		return record.Offset, record.Timestamp, p.writeNew(ctx, record)
+		return records, p.writeNew(ctx, records)
 	}
 
-	return record.Offset, record.Timestamp, p.write(ctx, record, number)
+	return records, p.write(ctx, records, number)
 }
 
-func (p *partition) writeNew(ctx context.Context, record record.Record) error {
-	log, physicalPosition, err := p.log.WriteNew(ctx, p.path, logExt, record)
+// timestamp chooses the timestamp of a new record according to the partition's TimestampType.
+func (p *partition) timestamp(requested time.Time) (time.Time, error) {
+	now := time.Now()
+
+	if p.TimestampType != record.CreateTime || requested.IsZero() {
+		return now, nil
+	}
+
+	if p.MaxTimestampSkew > 0 && (requested.Sub(now) > p.MaxTimestampSkew || now.Sub(requested) > p.MaxTimestampSkew) {
+		return time.Time{}, ErrTimestampOutOfRange
+	}
+
+	return requested, nil
+}
+
+// validExpiry reports, whether the expiry can be stored with the record:
+// it is kept in nanoseconds, so it has to fit into int64, and it can not be before the timestamp.
+func validExpiry(expiresAt time.Time, timestamp time.Time) bool {
+	if expiresAt.IsZero() {
+		return true
+	}
+
+	return !expiresAt.Before(timestamp) && !expiresAt.After(time.Unix(0, math.MaxInt64))
+}
+
+func (p *partition) writeNew(ctx context.Context, records []record.Record) error {
+	log, physicalPosition, err := p.log.WriteNew(ctx, p.path, logExt, records, p.encoding())
 	if err != nil {
 		p.logger.Error("failed to write into a new log", "err", err)
 		return err
 	}
 
+	maxTimestamp, err := p.insertIndexes(ctx, log, records, physicalPosition)
+	if err != nil {
+		p.removeNewLog(ctx, log)
+		return err
+	}
+
+	logs := p.Logs
 	p.Logs = append(p.Logs, log)
 
-	if err := p.index.Insert(ctx, p.timestampIndexPath(log), index.Pair{
-		Key:   record.Timestamp.UnixNano(),
-		Value: record.Offset,
-	}); err != nil {
-		p.logger.Error("failed to write into an index", "log", log, "err", err)
+	if err := p.commit(records, maxTimestamp); err != nil {
+		p.Logs = logs
+		p.removeNewLog(ctx, log)
 		return err
 	}
 
-	if err := p.index.Insert(ctx, p.offsetIndexPath(log), index.Pair{
-		Key:   record.Offset,
-		Value: physicalPosition,
-	}); err != nil {
-		p.logger.Error("failed to write into an index", "log", log, "err", err)
-		return err
+	if len(logs) != 0 {
+		p.closeLog(ctx, logs[len(logs)-1])
 	}
+	p.pinLog(log)
 
 	return nil
 }
 
-func (p *partition) write(ctx context.Context, record record.Record, log int64) error {
-	physicalPosition, err := p.log.Write(ctx, p.logPath(log), record)
+func (p *partition) write(ctx context.Context, records []record.Record, log int64) error {
+	physicalPosition, err := p.log.Write(ctx, p.logPath(log), records, p.encoding())
 	if err != nil {
 		p.logger.Error("failed to write into a log", "log", log, "err", err)
 		return err
 	}
 
-	if err := p.index.Insert(ctx, p.timestampIndexPath(log), index.Pair{
-		Key:   record.Timestamp.UnixNano(),
-		Value: record.Offset,
-	}); err != nil {
-		p.logger.Error("failed to write into an index", "log", log, "err", err)
+	maxTimestamp, err := p.insertIndexes(ctx, log, records, physicalPosition)
+	if err != nil {
+		p.truncateLog(ctx, log, physicalPosition)
+		return err
+	}
+
+	if err := p.commit(records, maxTimestamp); err != nil {
+		p.removeIndexes(ctx, log, records, physicalPosition, maxTimestamp)
+		p.truncateLog(ctx, log, physicalPosition)
 		return err
 	}
 
+	return nil
+}
+
+// commit consumes offsets of the written records and saves the partition's state.
+func (p *partition) commit(records []record.Record, maxTimestamp int64) error {
+	nextOffset, previousMaxTimestamp := p.NextOffset, p.MaxTimestamp
+
+	p.NextOffset += int64(len(records))
+	p.MaxTimestamp = maxTimestamp
+
+	if err := p.dump(); err != nil {
+		p.logger.Error("failed to dump the partition", "partition", p.Number, "err", err)
+
+		p.NextOffset, p.MaxTimestamp = nextOffset, previousMaxTimestamp
+		return err
+	}
+
+	p.publish()
+
+	return nil
+}
+
+func (p *partition) encoding() log.Encoding {
+	return log.Encoding{
+		Codec:  p.Compression,
+		Format: p.RecordFormat,
+	}
+}
+
+// insertIndexes adds the batch at the position into indexes of the log,
+// it returns the new maximum timestamp of the partition.
+func (p *partition) insertIndexes(ctx context.Context, log int64, records []record.Record, position int64) (int64, error) {
+	// the timestamp index keeps the maximum timestamp seen so far,
+	// so it stays sorted even if producers send timestamps out of order.
+	maxTimestamp := p.MaxTimestamp
+	for _, r := range records {
+		maxTimestamp = max(maxTimestamp, r.Timestamp.UnixNano())
+	}
+
+	timestampPair := index.Pair{Key: maxTimestamp, Value: records[0].Offset}
+	if err := p.index.Insert(ctx, p.timestampIndexPath(log), timestampPair); err != nil {
+		p.logger.Error("failed to write into an index", "log", log, "err", err)
+		return 0, err
+	}
+
 	if err := p.index.Insert(ctx, p.offsetIndexPath(log), index.Pair{
-		Key:   record.Offset,
-		Value: physicalPosition,
+		Key:   records[0].Offset,
+		Value: position,
 	}); err != nil {
 		p.logger.Error("failed to write into an index", "log", log, "err", err)
-		return err
+
+		if err := p.index.RemoveLast(context.WithoutCancel(ctx), p.timestampIndexPath(log), timestampPair); err != nil {
+			p.logger.Error("failed to revert an index", "log", log, "err", err)
+		}
+
+		return 0, err
 	}
 
-	return nil
+	return maxTimestamp, nil
+}
+
+// removeIndexes reverts insertIndexes.
+func (p *partition) removeIndexes(ctx context.Context, log int64, records []record.Record, position int64, maxTimestamp int64) {
+	ctx = context.WithoutCancel(ctx)
+
+	if err := p.index.RemoveLast(ctx, p.offsetIndexPath(log), index.Pair{
+		Key:   records[0].Offset,
+		Value: position,
+	}); err != nil {
+		p.logger.Error("failed to revert an index", "log", log, "err", err)
+	}
+
+	if err := p.index.RemoveLast(ctx, p.timestampIndexPath(log), index.Pair{
+		Key:   maxTimestamp,
+		Value: records[0].Offset,
+	}); err != nil {
+		p.logger.Error("failed to revert an index", "log", log, "err", err)
+	}
+}
+
+// truncateLog reverts a write into the log, that started at the position.
+func (p *partition) truncateLog(ctx context.Context, log int64, position int64) {
+	if err := p.log.Truncate(context.WithoutCancel(ctx), p.logPath(log), position); err != nil {
+		p.logger.Error("failed to revert a write into a log", "log", log, "err", err)
+	}
+}
+
+// removeNewLog deletes a log, which has failed to be added to the partition.
+func (p *partition) removeNewLog(ctx context.Context, log int64) {
+	ctx = context.WithoutCancel(ctx)
+
+	for _, err := range []error{
+		p.files.Remove(p.logPath(log)),
+		p.index.Remove(ctx, p.offsetIndexPath(log)),
+		p.index.Remove(ctx, p.timestampIndexPath(log)),
+	} {
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			p.logger.Error("failed to remove a new log", "log", log, "err", err)
+		}
+	}
+}
+
+// firstOffset returns the offset of the first record in the log.
+func (p *partition) firstOffset(ctx context.Context, log int64) (int64, error) {
+	pair, err := p.index.Ceiling(ctx, p.offsetIndexPath(log), math.MinInt64)
+	if err != nil {
+		p.logger.Error("failed to get the first index entry", "log", log, "err", err)
+		return 0, err
+	}
+
+	return pair.Key, nil
 }
 
+// readBatch reads the batch, that contains the offset.
+func (p *partition) readBatch(ctx context.Context, log int64, offset int64) ([]record.Record, error) {
+	pair, err := p.index.Floor(ctx, p.offsetIndexPath(log), offset)
+	if err != nil {
+		if err != io.EOF && !isRemoved(err) {
+			p.logger.Error("search in index failed", "log", log, "searched by", offset, "err", err)
+		}
+		return nil, err
+	}
+
+	records, err := p.log.Read(ctx, p.logPath(log), pair.Value)
+	if err != nil {
+		if !isRemoved(err) {
+			p.logger.Error("reading a log failed", "log", log, "searched by", pair.Value, "err", err)
+		}
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// ReadByOffset returns the record at the offset, an expired record is not returned: it is ErrRecordNotFound.
 func (p *partition) ReadByOffset(ctx context.Context, offset int64) (record.Record, error) {
-	p.mutex.RLock()
-	defer p.mutex.RUnlock()
+	v := p.snapshot()
 
-	for _, log := range p.Logs {
-		pos, err := p.index.Find(ctx, p.offsetIndexPath(log), offset)
+	if offset < 0 || offset >= v.highWatermark {
+		return record.Record{}, ErrRecordNotFound
+	}
+
+	// the newest log, which starts at or before the offset, contains it.
+	for i := len(v.logs) - 1; i >= 0; i-- {
+		records, err := p.readBatch(ctx, v.logs[i], offset)
 		if err != nil {
 			if err == io.EOF {
 				continue
 			}
 
-			p.logger.Error("search in index failed", "log", log, "searched by", offset, "err", err)
+			if isRemoved(err) {
+				break
+			}
+
 			return record.Record{}, err
 		}
 
-		r, err := p.log.Read(ctx, p.logPath(log), pos)
+		for _, r := range records {
+			if r.Offset == offset && !r.Expired(time.Now()) {
+				return r, nil
+			}
+		}
+
+		break
+	}
+
+	return record.Record{}, ErrRecordNotFound
+}
+
+// ReadRange returns up to count records, starting at the offset, ordered by offset.
+// Records of logs, which are deleted before or while they are read, are skipped, expired records are skipped too,
+// unless includeExpired is set. The returned offset is the next one after the range.
+func (p *partition) ReadRange(ctx context.Context, offset int64, count int64, includeExpired bool) ([]record.Record, int64, error) {
+	v := p.snapshot()
+
+	records, err := p.readRange(ctx, v, offset, count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !includeExpired {
+		records = unexpired(records, time.Now())
+	}
+
+	return records, max(min(offset+max(count, 0), v.highWatermark), offset), nil
+}
+
+// unexpired removes expired records from the records.
+func unexpired(records []record.Record, now time.Time) []record.Record {
+	return slices.DeleteFunc(records, func(r record.Record) bool {
+		return r.Expired(now)
+	})
+}
+
+func (p *partition) readRange(ctx context.Context, v view, offset int64, count int64) ([]record.Record, error) {
+	end := min(offset+max(count, 0), v.highWatermark)
+	if offset >= end {
+		return []record.Record{}, nil
+	}
+
+	// find the log and the batch to start with.
+	first, position := 0, int64(0)
+	for i := len(v.logs) - 1; i >= 0; i-- {
+		pair, err := p.index.Floor(ctx, p.offsetIndexPath(v.logs[i]), offset)
 		if err != nil {
-			p.logger.Error("reading a log failed", "log", log, "searched by", pos, "err", err)
-			return record.Record{}, err
+			if err == io.EOF || isRemoved(err) {
+				continue
+			}
+
+			p.logger.Error("search in index failed", "log", v.logs[i], "searched by", offset, "err", err)
+			return nil, err
 		}
 
-		return r, nil
+		first, position = i, pair.Value
+		break
 	}
 
-	return record.Record{}, errors.New("not found")
+	records := make([]record.Record, 0, min(end-offset, scanBuffer))
+	err := p.scan(ctx, v.logs[first:], position, func(r record.Record) bool {
+		if r.Offset >= end {
+			return false
+		}
+
+		if r.Offset >= offset {
+			records = append(records, r)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// scan streams records of the logs, starting at the position in the first one, until fn returns false.
+// Logs, which are deleted before or while they are read, are skipped.
+func (p *partition) scan(ctx context.Context, logs []int64, position int64, fn func(record.Record) bool) error {
+	for i, log := range logs {
+		if i != 0 {
+			position = 0
+		}
+
+		stream := p.log.Scan(ctx, p.logPath(log), position, scanBuffer)
+		for {
+			r, ok := stream.Next(ctx)
+			if !ok {
+				break
+			}
+
+			if !fn(r) {
+				stream.Close()
+				return nil
+			}
+		}
+
+		if err := stream.Err(); err != nil {
+			if isRemoved(err) {
+				continue
+			}
+
+			p.logger.Error("scanning a log failed", "log", log, "err", err)
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (p *partition) ReadByTimestamp(ctx context.Context, timestamp time.Time) (record.Record, error) {
-	p.mutex.RLock()
-	defer p.mutex.RUnlock()
+	v := p.snapshot()
 
-	for _, log := range p.Logs {
-		offset, err := p.index.Find(ctx, p.timestampIndexPath(log), timestamp.UnixNano())
+	for i, log := range v.logs {
+		// the first batch, where the maximum timestamp reaches requested.
+		pair, err := p.index.Ceiling(ctx, p.timestampIndexPath(log), timestamp.UnixNano())
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF || isRemoved(err) {
 				continue
 			}
 
@@ -171,32 +622,330 @@ func (p *partition) ReadByTimestamp(ctx context.Context, timestamp time.Time) (r
 			return record.Record{}, err
 		}
 
-		pos, err := p.index.Find(ctx, p.offsetIndexPath(log), offset)
+		if pair.Value >= v.highWatermark {
+			break
+		}
+
+		start, err := p.index.Floor(ctx, p.offsetIndexPath(log), pair.Value)
 		if err != nil {
-			p.logger.Error("search in index failed", "log", log, "searched by", offset, "err", err)
+			if isRemoved(err) {
+				continue
+			}
+
+			p.logger.Error("search in index failed", "log", log, "searched by", pair.Value, "err", err)
 			return record.Record{}, err
 		}
 
-		r, err := p.log.Read(ctx, p.logPath(log), pos)
+		// expired records are skipped, so the record may be in any later batch.
+		var (
+			found record.Record
+			ok    bool
+			now   = time.Now()
+		)
+		err = p.scan(ctx, v.logs[i:], start.Value, func(r record.Record) bool {
+			if r.Offset >= v.highWatermark {
+				return false
+			}
+
+			if !r.Timestamp.Before(timestamp) && !r.Expired(now) {
+				found, ok = r, true
+			}
+			return !ok
+		})
 		if err != nil {
-			p.logger.Error("reading a log failed", "log", log, "searched by", pos, "err", err)
 			return record.Record{}, err
 		}
 
-		return r, nil
+		if ok {
+			return found, nil
+		}
+
+		break
+	}
+
+	return record.Record{}, ErrRecordNotFound
+}
+
+// isRemoved reports, whether the error is caused by a log, which is removed after a snapshot was taken.
+func isRemoved(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// DeleteOldestLog removes the oldest log with its indexes, the active log is never removed.
+func (p *partition) DeleteOldestLog(ctx context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.Logs) < 2 {
+		return errors.New("no inactive logs")
+	}
+
+	number := p.Logs[0]
+	p.Logs = p.Logs[1:]
+
+	if err := p.dump(); err != nil {
+		p.logger.Error("failed to dump the partition", "err", err)
+		return err
+	}
+
+	p.publish()
+
+	p.logger.Info("deleting a log", "partition", p.Number, "log", number)
+
+	return errors.Join(
+		p.files.Remove(p.logPath(number)),
+		p.index.Remove(ctx, p.offsetIndexPath(number)),
+		p.index.Remove(ctx, p.timestampIndexPath(number)),
+	)
+}
+
+// DeleteExpiredLogs removes the oldest inactive logs, which contain only expired records.
+// Logs are checked without blocking writers, the lock is taken only to remove them from the partition.
+// It returns the amount of removed logs.
+func (p *partition) DeleteExpiredLogs(ctx context.Context) (int64, error) {
+	v := p.snapshot()
+	now := time.Now()
+
+	expired := 0
+	for ; expired < len(v.logs)-1; expired++ {
+		ok, err := p.expired(ctx, v.logs[expired], now)
+		if err != nil {
+			return 0, err
+		}
+
+		if !ok {
+			break
+		}
+	}
+
+	if expired == 0 {
+		return 0, nil
+	}
+
+	logs, err := p.removeLogs(v.logs[:expired])
+	if err != nil {
+		return 0, err
 	}
 
-	return record.Record{}, errors.New("not found")
+	var errs []error
+	for _, number := range logs {
+		p.logger.Info("deleting an expired log", "partition", p.Number, "log", number)
+
+		errs = append(errs,
+			p.files.Remove(p.logPath(number)),
+			p.index.Remove(ctx, p.offsetIndexPath(number)),
+			p.index.Remove(ctx, p.timestampIndexPath(number)),
+		)
+	}
+
+	return int64(expired), errors.Join(errs...)
 }
 
+// expired reports, whether all records of the log are expired at the time.
+func (p *partition) expired(ctx context.Context, log int64, now time.Time) (bool, error) {
+	expired := true
+	err := p.scan(ctx, []int64{log}, 0, func(r record.Record) bool {
+		expired = r.Expired(now)
+		return expired
+	})
+
+	return expired, err
+}
+
+// removeLogs removes the oldest logs from the partition, if it still starts with them.
+func (p *partition) removeLogs(logs []int64) ([]int64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.Logs) <= len(logs) || !slices.Equal(p.Logs[:len(logs)], logs) {
+		return nil, ErrLogsChanged
+	}
+
+	previous := p.Logs
+	p.Logs = slices.Clone(p.Logs[len(logs):])
+
+	if err := p.dump(); err != nil {
+		p.logger.Error("failed to dump the partition", "err", err)
+
+		p.Logs = previous
+		return nil, err
+	}
+
+	p.publish()
+
+	return logs, nil
+}
+
+// closeLog is called when the log is no longer active.
+func (p *partition) closeLog(ctx context.Context, number int64) {
+	p.unpinLog(number)
+
+	if err := p.index.Seal(ctx, p.offsetIndexPath(number)); err != nil {
+		p.logger.Warn("failed to seal an index", "log", number, "err", err)
+	}
+
+	if err := p.index.Seal(ctx, p.timestampIndexPath(number)); err != nil {
+		p.logger.Warn("failed to seal an index", "log", number, "err", err)
+	}
+}
+
+// pinLog keeps files of the active log open.
+func (p *partition) pinLog(number int64) {
+	p.files.Pin(p.logPath(number))
+	p.files.Pin(p.offsetIndexPath(number))
+	p.files.Pin(p.timestampIndexPath(number))
+}
+
+func (p *partition) unpinLog(number int64) {
+	p.files.Unpin(p.logPath(number))
+	p.files.Unpin(p.offsetIndexPath(number))
+	p.files.Unpin(p.timestampIndexPath(number))
+}
+
+// HighWatermark returns the offset after the last committed record.
+func (p *partition) HighWatermark() int64 {
+	return p.nextOffset()
+}
+
+// HeadTimestamp returns the maximum timestamp of committed records,
+// it is zero, when the partition is empty.
+func (p *partition) HeadTimestamp() time.Time {
+	v := p.snapshot()
+
+	if v.highWatermark == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, v.maxTimestamp)
+}
+
+// OffsetTimestamp returns the timestamp of the offset from the timestamp index without reading the log.
+// The index keeps the running maximum of timestamps per batch, so it is the newest timestamp up to the batch,
+// which contains the offset.
+func (p *partition) OffsetTimestamp(ctx context.Context, offset int64) (time.Time, error) {
+	v := p.snapshot()
+
+	if offset < 0 || offset >= v.highWatermark {
+		return time.Time{}, ErrRecordNotFound
+	}
+
+	// the newest log, which starts at or before the offset, contains it, offsets of the index are sorted as well.
+	for i := len(v.logs) - 1; i >= 0; i-- {
+		pair, err := p.index.FloorValue(ctx, p.timestampIndexPath(v.logs[i]), offset)
+		if err != nil {
+			if err == io.EOF {
+				continue
+			}
+
+			if isRemoved(err) {
+				break
+			}
+
+			p.logger.Error("search in index failed", "log", v.logs[i], "searched by", offset, "err", err)
+			return time.Time{}, err
+		}
+
+		return time.Unix(0, pair.Key), nil
+	}
+
+	return time.Time{}, ErrRecordNotFound
+}
+
+// LowWatermark returns the offset of the first record, which is still stored.
+func (p *partition) LowWatermark(ctx context.Context) (int64, error) {
+	v := p.snapshot()
+
+	if len(v.logs) == 0 {
+		return v.highWatermark, nil
+	}
+
+	return p.firstOffset(ctx, v.logs[0])
+}
+
+// Latest returns the last committed record in the partition, which has not expired.
+// Records are read backwards in chunks, until an unexpired one is found.
+func (p *partition) Latest(ctx context.Context) (record.Record, error) {
+	v := p.snapshot()
+
+	if v.highWatermark == 0 {
+		return record.Record{}, ErrPartitionIsEmpty
+	}
+
+	if len(v.logs) == 0 {
+		return record.Record{}, ErrRecordNotFound
+	}
+
+	first, err := p.firstOffset(ctx, v.logs[0])
+	if err != nil {
+		if isRemoved(err) {
+			return p.Latest(ctx)
+		}
+		return record.Record{}, err
+	}
+
+	now := time.Now()
+	for end := v.highWatermark; end > first; end -= latestChunk {
+		records, err := p.readRange(ctx, v, max(end-latestChunk, first), min(end-first, latestChunk))
+		if err != nil {
+			return record.Record{}, err
+		}
+
+		for i := len(records) - 1; i >= 0; i-- {
+			if !records[i].Expired(now) {
+				return records[i], nil
+			}
+		}
+	}
+
+	return record.Record{}, ErrRecordNotFound
+}
+
+// Tail returns up to n last committed records in the partition, ordered by offset.
+func (p *partition) Tail(ctx context.Context, n int64) ([]record.Record, error) {
+	v := p.snapshot()
+
+	if v.highWatermark == 0 {
+		return nil, ErrPartitionIsEmpty
+	}
+
+	records, err := p.readRange(ctx, v, v.highWatermark-n, n)
+	if err != nil {
+		return nil, err
+	}
+
+	return unexpired(records, time.Now()), nil
+}
+
+// delete removes all files of the partition, the partition must not be used after it.
+func (p *partition) delete(ctx context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.logger.Info("deleting the partition", "partition", p.Number)
+
+	var errs []error
+	for _, number := range p.Logs {
+		errs = append(errs,
+			p.files.Remove(p.logPath(number)),
+			p.index.Remove(ctx, p.offsetIndexPath(number)),
+			p.index.Remove(ctx, p.timestampIndexPath(number)),
+		)
+	}
+
+	p.appended.Close()
+
+	return errors.Join(append(errs, os.RemoveAll(p.path))...)
+}
+
+// dump saves the state of the partition, the file is replaced atomically,
+// so a crash never leaves a partially written state behind.
 func (p *partition) dump() error {
-	file, err := os.OpenFile(p.partPath(), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	data, err := json.Marshal(p)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	return json.NewEncoder(file).Encode(p)
+	return files.WriteFile(p.partPath(), append(data, '\n'))
 }
 
 func (p *partition) offsetIndexPath(n int64) string {
@@ -214,3 +963,65 @@ func (p *partition) logPath(number int64) string {
 func (p *partition) partPath() string {
 	return fmt.Sprintf("%s/%08d.%s", p.path, p.Number, partExt)
 }
+
+// newPartition creates an empty partition in the directory.
+func newPartition(logger *slog.Logger, path string, number int64, config Config, index index.Index, log log.Log, files *files.Cache) (*partition, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	p := &partition{
+		logger: logger,
+		index:  index,
+		log:    log,
+		files:  files,
+		path:   path,
+		Number: number,
+		Logs:   []int64{},
+		Config: config,
+	}
+
+	if err := p.dump(); err != nil {
+		return nil, err
+	}
+
+	p.publish()
+
+	return p, nil
+}
+
+// loadPartition restores the partition from its directory, a read-only partition is not recovered.
+func loadPartition(logger *slog.Logger, path string, number int64, index index.Index, log log.Log, files *files.Cache, readOnly bool) (*partition, error) {
+	p := &partition{
+		logger: logger,
+		index:  index,
+		log:    log,
+		files:  files,
+		path:   path,
+		Number: number,
+	}
+
+	data, err := os.ReadFile(p.partPath())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+
+	if !readOnly {
+		if err := p.recover(context.Background()); err != nil {
+			logger.Error("failed to recover the partition", "partition", number, "err", err)
+			return nil, err
+		}
+	}
+
+	if len(p.Logs) != 0 {
+		p.pinLog(p.Logs[len(p.Logs)-1])
+	}
+
+	p.publish()
+
+	return p, nil
+}
@@ -0,0 +1,101 @@
+package partition
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/indigowar/dmq/internal/partition/files"
+	"github.com/indigowar/dmq/internal/partition/index"
+)
+
+// recover brings files of the partition back to its saved state after a crash:
+// a batch is written into the log and indexes before NextOffset is saved,
+// so entries of offsets at or after NextOffset are not committed and are dropped.
+// Logs, which are not in the partition, were created by an interrupted append or compaction and are removed.
+func (p *partition) recover(ctx context.Context) error {
+	if err := p.removeOrphans(ctx); err != nil {
+		return err
+	}
+
+	if len(p.Logs) == 0 {
+		return nil
+	}
+
+	active := p.Logs[len(p.Logs)-1]
+
+	last, err := p.dropUncommitted(ctx, p.offsetIndexPath(active), func(pair index.Pair) int64 { return pair.Key })
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.dropUncommitted(ctx, p.timestampIndexPath(active), func(pair index.Pair) int64 { return pair.Value }); err != nil {
+		return err
+	}
+
+	// the last committed batch is at the position of the last pair in the offset index.
+	return p.log.TruncateAfter(ctx, p.logPath(active), last.Value)
+}
+
+// dropUncommitted removes the last pairs of the index, while their offset is not committed,
+// it returns the last pair, which is left.
+func (p *partition) dropUncommitted(ctx context.Context, filename string, offset func(index.Pair) int64) (index.Pair, error) {
+	for {
+		pair, err := p.index.Latest(ctx, filename)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return index.Pair{}, ErrCorruptedPartition
+			}
+			return index.Pair{}, err
+		}
+
+		if offset(pair) < p.NextOffset {
+			return pair, nil
+		}
+
+		p.logger.Warn("dropping an uncommitted batch", "partition", p.Number, "index", filename, "offset", offset(pair))
+
+		if err := p.index.RemoveLast(ctx, filename, pair); err != nil {
+			return index.Pair{}, err
+		}
+	}
+}
+
+// removeOrphans deletes logs and indexes, which do not belong to the partition, and unfinished temporary files.
+func (p *partition) removeOrphans(ctx context.Context) error {
+	entries, err := os.ReadDir(p.path)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		path := filepath.Join(p.path, entry.Name())
+
+		if strings.HasSuffix(entry.Name(), files.TempExt) {
+			errs = append(errs, os.Remove(path))
+			continue
+		}
+
+		ext := filepath.Ext(entry.Name())
+		number, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), ext), 10, 64)
+		if err != nil || slices.Contains(p.Logs, number) {
+			continue
+		}
+
+		switch strings.TrimPrefix(ext, ".") {
+		case logExt:
+			p.logger.Warn("removing an orphan log", "partition", p.Number, "log", number)
+			errs = append(errs, p.files.Remove(path))
+		case offsetIdxExt, timestampIdxExt:
+			errs = append(errs, p.index.Remove(ctx, path))
+		}
+	}
+
+	return errors.Join(errs...)
+}
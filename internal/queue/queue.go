@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/indigowar/dmq/internal/compacted"
+	"github.com/indigowar/dmq/internal/registry"
+)
+
+// State is a state of a delivered record.
+type State string
+
+const (
+	// InFlight record is leased by a consumer until the deadline.
+	InFlight State = "in_flight"
+	// Available record is delivered again after the deadline.
+	Available State = "available"
+	Acked     State = "acked"
+	// Dead record has exceeded the maximum amount of deliveries.
+	Dead State = "dead"
+)
+
+// cursorOffset is the offset in the key of the queue's cursor.
+const cursorOffset = -1
+
+// stateKey is the key of a record in the state topic,
+// it identifies either a delivered record or the cursor of a queue.
+type stateKey struct {
+	Topic     string `json:"topic"`
+	Partition int64  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+type cursor struct {
+	Floor int64 `json:"floor"`
+}
+
+type message struct {
+	State      State     `json:"state"`
+	Deliveries int64     `json:"deliveries"`
+	Deadline   time.Time `json:"deadline"`
+}
+
+func (m *message) completed() bool {
+	return m.State == Acked || m.State == Dead
+}
+
+// visible reports whether the record can be delivered at the time.
+func (m *message) visible(now time.Time) bool {
+	return (m.State == Available || m.State == InFlight) && !m.Deadline.After(now)
+}
+
+// queue is a state of a partition in the queue mode.
+// Records before the floor are completed, records from the next have never been delivered,
+// records in between have a message, unless they were removed from the partition.
+type queue struct {
+	mutex sync.Mutex
+
+	topic     string
+	partition int64
+	config    registry.QueueConfig
+
+	floor    int64
+	next     int64
+	messages map[int64]*message
+
+	state *compacted.Log
+	// removed is set, when the topic is deleted, so the queue does not store states anymore.
+	removed bool
+}
+
+// visible returns offsets of records, which can be delivered again at the time, in ascending order.
+func (q *queue) visible(now time.Time) []int64 {
+	var offsets []int64
+	for offset, m := range q.messages {
+		if m.visible(now) {
+			offsets = append(offsets, offset)
+		}
+	}
+	slices.Sort(offsets)
+
+	return offsets
+}
+
+// exhausted reports whether the record must not be delivered again.
+func (q *queue) exhausted(m *message) bool {
+	return q.config.MaxDeliveries > 0 && m.Deliveries >= q.config.MaxDeliveries
+}
+
+// set saves the new state of the record.
+func (q *queue) set(ctx context.Context, offset int64, m message) error {
+	if err := q.put(ctx, offset, m); err != nil {
+		return err
+	}
+
+	q.messages[offset] = &m
+	return nil
+}
+
+// advance moves the floor over completed records and forgets them.
+func (q *queue) advance(ctx context.Context) error {
+	floor := q.floor
+	for floor < q.next {
+		if m, ok := q.messages[floor]; ok && !m.completed() {
+			break
+		}
+		floor++
+	}
+
+	if floor == q.floor {
+		return nil
+	}
+
+	if err := q.put(ctx, cursorOffset, cursor{Floor: floor}); err != nil {
+		return err
+	}
+
+	for offset := q.floor; offset != floor; offset++ {
+		if _, ok := q.messages[offset]; !ok {
+			continue
+		}
+
+		delete(q.messages, offset)
+		// a lost tombstone is harmless, records before the floor are ignored on load.
+		if err := q.delete(ctx, offset); err != nil {
+			break
+		}
+	}
+
+	q.floor = floor
+	return nil
+}
+
+func (q *queue) put(ctx context.Context, offset int64, value any) error {
+	if q.removed {
+		return registry.ErrTopicNotFound
+	}
+
+	key, err := json.Marshal(stateKey{Topic: q.topic, Partition: q.partition, Offset: offset})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return q.state.Put(ctx, key, data)
+}
+
+func (q *queue) delete(ctx context.Context, offset int64) error {
+	key, err := json.Marshal(stateKey{Topic: q.topic, Partition: q.partition, Offset: offset})
+	if err != nil {
+		return err
+	}
+
+	return q.state.Put(ctx, key, nil)
+}
@@ -0,0 +1,205 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/indigowar/dmq/internal/core/communication"
+	"github.com/indigowar/dmq/internal/partition/files"
+	"github.com/indigowar/dmq/internal/partition/index"
+	"github.com/indigowar/dmq/internal/partition/log"
+	"github.com/indigowar/dmq/internal/registry"
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+const testTopic = "jobs"
+
+// openTestQueues opens topics and queues in the directory, as it is done on a start of the broker,
+// the returned function stops them, so they can be opened again.
+func openTestQueues(t *testing.T, dir string) (*Queues, func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var (
+		pool   = communication.PoolConfig{Min: 1, Max: 2}
+		cache  = files.NewCache(16)
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	)
+
+	stop := sync.OnceFunc(func() {
+		cancel()
+		cache.Close()
+	})
+	t.Cleanup(stop)
+
+	topics, err := registry.NewRegistry(logger, dir, index.InitIndex(ctx, pool, cache), log.InitLog(ctx, pool, cache, log.DefaultMaxEntrySize), cache)
+	if err != nil {
+		t.Fatalf("failed to open topics: %v", err)
+	}
+
+	s, err := NewQueues(ctx, logger, topics)
+	if err != nil {
+		t.Fatalf("failed to open queues: %v", err)
+	}
+
+	return s, stop
+}
+
+// newTestQueue creates the queue topic with the records.
+func newTestQueue(t *testing.T, s *Queues, config registry.Config, records int) {
+	t.Helper()
+
+	config.Partitions, config.Queue.Enabled = 1, true
+	if _, err := s.topics.Create(context.Background(), testTopic, config); err != nil {
+		t.Fatalf("failed to create the topic: %v", err)
+	}
+
+	for i := 0; i < records; i++ {
+		if _, err := s.topics.Write(context.Background(), topic.WriteIntoTopicRequest{Topic: testTopic, Value: []byte{byte(i)}}); err != nil {
+			t.Fatalf("failed to write a record: %v", err)
+		}
+	}
+}
+
+func receive(t *testing.T, s *Queues, max int64) []topic.QueueMessage {
+	t.Helper()
+
+	response, err := s.Receive(context.Background(), topic.ReceiveRequest{Topic: testTopic, Max: max})
+	if err != nil {
+		t.Fatalf("failed to receive records: %v", err)
+	}
+
+	return response.Messages
+}
+
+// checkReceived checks offsets and deliveries of the received messages.
+func checkReceived(t *testing.T, messages []topic.QueueMessage, offsets []int64, delivery int64) {
+	t.Helper()
+
+	actual := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		actual = append(actual, m.Offset)
+
+		if m.Delivery != delivery {
+			t.Fatalf("expected the delivery %d of the offset %d, got %d", delivery, m.Offset, m.Delivery)
+		}
+	}
+
+	if !slices.Equal(actual, offsets) {
+		t.Fatalf("expected offsets %v, got %v", offsets, actual)
+	}
+}
+
+func ack(t *testing.T, s *Queues, offset int64, delivery int64) {
+	t.Helper()
+
+	if err := s.Ack(context.Background(), topic.AckRequest{Topic: testTopic, Offset: offset, Delivery: delivery}); err != nil {
+		t.Fatalf("failed to acknowledge the offset %d: %v", offset, err)
+	}
+}
+
+func nack(t *testing.T, s *Queues, offset int64, delivery int64) {
+	t.Helper()
+
+	if err := s.Nack(context.Background(), topic.NackRequest{Topic: testTopic, Offset: offset, Delivery: delivery}); err != nil {
+		t.Fatalf("failed to return the offset %d: %v", offset, err)
+	}
+}
+
+func TestAckIsKeptAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	s, stop := openTestQueues(t, dir)
+	newTestQueue(t, s, registry.Config{Queue: registry.QueueConfig{VisibilityTimeout: time.Hour}}, 3)
+
+	checkReceived(t, receive(t, s, 2), []int64{0, 1}, 1)
+	ack(t, s, 0, 1)
+	ack(t, s, 1, 1)
+
+	err := s.Ack(context.Background(), topic.AckRequest{Topic: testTopic, Offset: 0, Delivery: 1})
+	if !errors.Is(err, ErrUnknownDelivery) {
+		t.Fatalf("expected an acknowledged record to be unknown, got %v", err)
+	}
+
+	stop()
+	s, _ = openTestQueues(t, dir)
+
+	checkReceived(t, receive(t, s, 10), []int64{2}, 1)
+}
+
+func TestNackPastMaxDeliveriesMovesToDeadLetter(t *testing.T) {
+	s, _ := openTestQueues(t, t.TempDir())
+
+	if _, err := s.topics.Create(context.Background(), "failed", registry.Config{Partitions: 1}); err != nil {
+		t.Fatalf("failed to create the dead letter topic: %v", err)
+	}
+
+	newTestQueue(t, s, registry.Config{
+		Queue:      registry.QueueConfig{MaxDeliveries: 2},
+		DeadLetter: registry.DeadLetterConfig{Topic: "failed"},
+	}, 1)
+
+	checkReceived(t, receive(t, s, 1), []int64{0}, 1)
+	nack(t, s, 0, 1)
+
+	checkReceived(t, receive(t, s, 1), []int64{0}, 2)
+	nack(t, s, 0, 2)
+
+	checkReceived(t, receive(t, s, 1), []int64{}, 0)
+
+	partitions, err := s.topics.Partitions("failed")
+	if err != nil {
+		t.Fatalf("failed to get the dead letter topic: %v", err)
+	}
+
+	r, err := partitions.ReadByOffset(context.Background(), topic.ReadByOffsetFromPartitionRequest{Offset: 0})
+	if err != nil || !slices.Equal(r.Value, []byte{0}) {
+		t.Fatalf("expected the record in the dead letter topic, got %v: %v", r, err)
+	}
+}
+
+func TestExpiredLeaseIsRedelivered(t *testing.T) {
+	s, _ := openTestQueues(t, t.TempDir())
+	newTestQueue(t, s, registry.Config{Queue: registry.QueueConfig{VisibilityTimeout: 50 * time.Millisecond}}, 1)
+
+	checkReceived(t, receive(t, s, 1), []int64{0}, 1)
+	checkReceived(t, receive(t, s, 1), []int64{}, 0)
+
+	time.Sleep(100 * time.Millisecond)
+
+	checkReceived(t, receive(t, s, 1), []int64{0}, 2)
+
+	err := s.Ack(context.Background(), topic.AckRequest{Topic: testTopic, Offset: 0, Delivery: 1})
+	if !errors.Is(err, ErrUnknownDelivery) {
+		t.Fatalf("expected an expired delivery to be unknown, got %v", err)
+	}
+
+	ack(t, s, 0, 2)
+}
+
+func TestInFlightRecordsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	s, stop := openTestQueues(t, dir)
+	newTestQueue(t, s, registry.Config{Queue: registry.QueueConfig{VisibilityTimeout: time.Hour}}, 3)
+
+	checkReceived(t, receive(t, s, 2), []int64{0, 1}, 1)
+
+	stop()
+	s, _ = openTestQueues(t, dir)
+
+	// leased records are hidden until their deadline, as before the restart.
+	checkReceived(t, receive(t, s, 10), []int64{2}, 1)
+
+	ack(t, s, 0, 1)
+	nack(t, s, 1, 1)
+
+	checkReceived(t, receive(t, s, 10), []int64{1}, 2)
+}
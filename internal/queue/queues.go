@@ -0,0 +1,539 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/indigowar/dmq/internal/compacted"
+	"github.com/indigowar/dmq/internal/deadletter"
+	"github.com/indigowar/dmq/internal/partition"
+	"github.com/indigowar/dmq/internal/registry"
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+// StateTopic is the internal topic, which stores states of delivered records of all queues.
+const StateTopic = "__queue_state"
+
+var (
+	ErrNotAQueue         = errors.New("topic is not in the queue mode")
+	ErrUnknownDelivery   = errors.New("record is not delivered or the delivery has expired")
+	ErrCorruptedState    = errors.New("corrupted queue state")
+	ErrInvalidMaxRecords = errors.New("invalid maximum amount of records")
+)
+
+const defaultVisibilityTimeout = 30 * time.Second
+
+// pollInterval is the longest wait for new records, before records with expired leases are checked again.
+const pollInterval = 100 * time.Millisecond
+
+type queueKey struct {
+	Topic     string
+	Partition int64
+}
+
+// Queues delivers records of topics in the queue mode to competing consumers.
+// States of delivered records are stored in the state topic and kept in memory.
+type Queues struct {
+	logger *slog.Logger
+
+	mutex  sync.Mutex
+	queues map[queueKey]*queue
+
+	topics *registry.Registry
+	state  *compacted.Log
+	router *deadletter.Router
+}
+
+func (s *Queues) Receive(ctx context.Context, request topic.ReceiveRequest) (topic.ReceiveResponse, error) {
+	if request.Max == 0 {
+		request.Max = 1
+	}
+
+	if request.Max < 0 {
+		return topic.ReceiveResponse{}, ErrInvalidMaxRecords
+	}
+
+	config, err := s.config(request.Topic)
+	if err != nil {
+		return topic.ReceiveResponse{}, err
+	}
+
+	partitions, err := s.topics.Partitions(request.Topic)
+	if err != nil {
+		return topic.ReceiveResponse{}, err
+	}
+
+	q, err := s.queue(ctx, request.Topic, request.Partition, config, partitions)
+	if err != nil {
+		return topic.ReceiveResponse{}, err
+	}
+
+	visibility := request.VisibilityTimeout
+	if visibility <= 0 {
+		visibility = config.VisibilityTimeout
+	}
+	if visibility <= 0 {
+		visibility = defaultVisibilityTimeout
+	}
+
+	deadline := time.Now().Add(request.MaxWait)
+	for {
+		messages, next, delayed, err := s.receive(ctx, q, partitions, request.Max, visibility)
+		if err != nil || len(messages) != 0 {
+			return topic.ReceiveResponse{Messages: messages}, err
+		}
+
+		wait := min(time.Until(deadline), pollInterval)
+		if wait <= 0 {
+			return topic.ReceiveResponse{Messages: []topic.QueueMessage{}}, nil
+		}
+
+		// new records exist, but they are not due yet.
+		if delayed {
+			select {
+			case <-ctx.Done():
+				return topic.ReceiveResponse{}, ctx.Err()
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		if _, err := partitions.WaitFor(ctx, topic.WaitForPartitionRequest{
+			Partition:  request.Partition,
+			Offset:     next,
+			MinRecords: 1,
+			MaxWait:    wait,
+		}); err != nil {
+			return topic.ReceiveResponse{}, err
+		}
+	}
+}
+
+// receive leases up to max records: records, which are visible again, go first, then new ones.
+// It returns the offset of the next new record and whether new records are delayed by the DeliveryDelay.
+func (s *Queues) receive(ctx context.Context, q *queue, partitions *partition.Manager, max int64, visibility time.Duration) ([]topic.QueueMessage, int64, bool, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	messages := []topic.QueueMessage{}
+
+	for _, offset := range q.visible(now) {
+		if int64(len(messages)) == max {
+			break
+		}
+
+		m := *q.messages[offset]
+
+		r, err := partitions.ReadByOffset(ctx, topic.ReadByOffsetFromPartitionRequest{Partition: q.partition, Offset: offset})
+		if err != nil {
+			if !errors.Is(err, partition.ErrRecordNotFound) {
+				return nil, 0, false, err
+			}
+
+			// the record is removed from the partition, so there is nothing to deliver.
+			if err := q.set(ctx, offset, message{State: Acked, Deliveries: m.Deliveries}); err != nil {
+				return nil, 0, false, err
+			}
+			continue
+		}
+
+		if q.exhausted(&m) {
+			if err := s.giveUp(ctx, q, r, m, "exceeded the maximum amount of deliveries"); err != nil {
+				return nil, 0, false, err
+			}
+			continue
+		}
+
+		leased, err := s.lease(ctx, q, r, m.Deliveries, now.Add(visibility))
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		messages = append(messages, leased)
+	}
+
+	delayed := false
+	for int64(len(messages)) != max && !delayed {
+		response, err := partitions.ReadRange(ctx, topic.ReadRangeFromPartitionRequest{
+			Partition: q.partition,
+			Offset:    q.next,
+			Count:     max - int64(len(messages)),
+		})
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		if len(response.Records) == 0 {
+			// the range may consist of expired records only.
+			if response.NextOffset <= q.next {
+				break
+			}
+
+			q.next = response.NextOffset
+			continue
+		}
+
+		for _, r := range response.Records {
+			if q.config.DeliveryDelay > 0 && r.Timestamp.Add(q.config.DeliveryDelay).After(now) {
+				delayed = true
+				break
+			}
+
+			leased, err := s.lease(ctx, q, r, 0, now.Add(visibility))
+			if err != nil {
+				return nil, 0, false, err
+			}
+
+			messages = append(messages, leased)
+			q.next = r.Offset + 1
+		}
+
+		if !delayed && response.NextOffset > q.next {
+			q.next = response.NextOffset
+		}
+	}
+
+	return messages, q.next, delayed, q.advance(ctx)
+}
+
+// giveUp moves the record into the dead letter topic, the record is dropped, if the topic has none.
+// A deleted destination and an expiry, which has passed meanwhile, drop the record as well,
+// otherwise the queue would retry it forever.
+func (s *Queues) giveUp(ctx context.Context, q *queue, r topic.ReadFromPartitionResponse, m message, reason string) error {
+	_, err := s.router.Forward(ctx, deadletter.Failure{
+		Topic:     q.topic,
+		Partition: q.partition,
+		Record:    r,
+		Reason:    reason,
+		Attempts:  m.Deliveries,
+	})
+	if errors.Is(err, deadletter.ErrNoDeadLetterTopic) || errors.Is(err, registry.ErrTopicNotFound) ||
+		errors.Is(err, partition.ErrInvalidExpiry) {
+		s.logger.Warn("dropped a failed record", "topic", q.topic, "partition", q.partition, "offset", r.Offset, "reason", reason, "err", err)
+	} else if err != nil {
+		return err
+	}
+
+	return q.set(ctx, r.Offset, message{State: Dead, Deliveries: m.Deliveries})
+}
+
+func (s *Queues) lease(ctx context.Context, q *queue, r topic.ReadFromPartitionResponse, deliveries int64, deadline time.Time) (topic.QueueMessage, error) {
+	m := message{State: InFlight, Deliveries: deliveries + 1, Deadline: deadline}
+	if err := q.set(ctx, r.Offset, m); err != nil {
+		return topic.QueueMessage{}, err
+	}
+
+	return topic.QueueMessage{
+		ReadFromPartitionResponse: r,
+		Delivery:                  m.Deliveries,
+		Deadline:                  m.Deadline,
+	}, nil
+}
+
+// Ack completes the record, only the latest delivery can be acknowledged.
+func (s *Queues) Ack(ctx context.Context, request topic.AckRequest) error {
+	q, m, err := s.delivered(request.Topic, request.Partition, request.Offset, request.Delivery)
+	if err != nil {
+		return err
+	}
+	defer q.mutex.Unlock()
+
+	if err := q.set(ctx, request.Offset, message{State: Acked, Deliveries: m.Deliveries}); err != nil {
+		return err
+	}
+
+	return q.advance(ctx)
+}
+
+// Nack returns the record into the queue, unless it has exceeded the maximum amount of deliveries.
+func (s *Queues) Nack(ctx context.Context, request topic.NackRequest) error {
+	q, m, err := s.delivered(request.Topic, request.Partition, request.Offset, request.Delivery)
+	if err != nil {
+		return err
+	}
+	defer q.mutex.Unlock()
+
+	if q.exhausted(&m) {
+		if err := s.reject(ctx, q, request.Offset, m, "exceeded the maximum amount of deliveries"); err != nil {
+			return err
+		}
+
+		return q.advance(ctx)
+	}
+
+	next := message{State: Available, Deliveries: m.Deliveries, Deadline: time.Now().Add(request.Delay)}
+	if err := q.set(ctx, request.Offset, next); err != nil {
+		return err
+	}
+
+	return q.advance(ctx)
+}
+
+// Reject moves the record into the next retry topic or the dead letter topic, without delivering it again.
+func (s *Queues) Reject(ctx context.Context, request topic.RejectRequest) error {
+	q, m, err := s.delivered(request.Topic, request.Partition, request.Offset, request.Delivery)
+	if err != nil {
+		return err
+	}
+	defer q.mutex.Unlock()
+
+	if err := s.reject(ctx, q, request.Offset, m, request.Reason); err != nil {
+		return err
+	}
+
+	return q.advance(ctx)
+}
+
+func (s *Queues) reject(ctx context.Context, q *queue, offset int64, m message, reason string) error {
+	partitions, err := s.topics.Partitions(q.topic)
+	if err != nil {
+		return err
+	}
+
+	r, err := partitions.ReadByOffset(ctx, topic.ReadByOffsetFromPartitionRequest{Partition: q.partition, Offset: offset})
+	if err != nil {
+		if errors.Is(err, partition.ErrRecordNotFound) {
+			return q.set(ctx, offset, message{State: Acked, Deliveries: m.Deliveries})
+		}
+
+		return err
+	}
+
+	return s.giveUp(ctx, q, r, m, reason)
+}
+
+// delivered returns the locked queue and the state of the record, if the delivery is the latest one.
+func (s *Queues) delivered(name string, number int64, offset int64, delivery int64) (*queue, message, error) {
+	config, err := s.config(name)
+	if err != nil {
+		return nil, message{}, err
+	}
+
+	s.mutex.Lock()
+	q, ok := s.queues[queueKey{Topic: name, Partition: number}]
+	s.mutex.Unlock()
+
+	if !ok {
+		return nil, message{}, ErrUnknownDelivery
+	}
+
+	q.mutex.Lock()
+	q.config = config
+
+	m, ok := q.messages[offset]
+	if !ok || m.State != InFlight || m.Deliveries != delivery {
+		q.mutex.Unlock()
+		return nil, message{}, ErrUnknownDelivery
+	}
+
+	return q, *m, nil
+}
+
+func (s *Queues) config(name string) (registry.QueueConfig, error) {
+	config, err := s.topics.Config(name)
+	if err != nil {
+		return registry.QueueConfig{}, err
+	}
+
+	if !config.Queue.Enabled {
+		return registry.QueueConfig{}, ErrNotAQueue
+	}
+
+	return config.Queue, nil
+}
+
+// queue returns the queue of the partition, a new queue starts from the first stored record.
+func (s *Queues) queue(ctx context.Context, name string, number int64, config registry.QueueConfig, partitions *partition.Manager) (*queue, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := queueKey{Topic: name, Partition: number}
+	if q, ok := s.queues[key]; ok {
+		q.mutex.Lock()
+		q.config = config
+		q.mutex.Unlock()
+
+		return q, nil
+	}
+
+	first, err := partitions.LowWatermark(ctx, topic.LowWatermarkRequest{Partition: number})
+	if err != nil {
+		return nil, err
+	}
+
+	q := s.newQueue(key, first.Offset)
+	q.config = config
+
+	if err := q.put(ctx, cursorOffset, cursor{Floor: q.floor}); err != nil {
+		return nil, err
+	}
+
+	s.queues[key] = q
+	return q, nil
+}
+
+func (s *Queues) newQueue(key queueKey, floor int64) *queue {
+	return &queue{
+		topic:     key.Topic,
+		partition: key.Partition,
+		floor:     floor,
+		next:      floor,
+		messages:  make(map[int64]*message),
+		state:     s.state,
+	}
+}
+
+// forget removes states of queues of the deleted topic.
+// The state topic is read, because tombstones of completed records may be lost, so they are not in memory.
+func (s *Queues) forget(ctx context.Context, name string) error {
+	s.mutex.Lock()
+	var queues []*queue
+	for key, q := range s.queues {
+		if key.Topic == name {
+			queues = append(queues, q)
+			delete(s.queues, key)
+		}
+	}
+	s.mutex.Unlock()
+
+	// receivers, which still use queues, must not store states after they are removed.
+	for _, q := range queues {
+		q.mutex.Lock()
+		q.removed = true
+		q.mutex.Unlock()
+	}
+
+	stored := make(map[string]bool)
+	err := s.state.Load(ctx, func(data []byte, value []byte) error {
+		var key stateKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return fmt.Errorf("%w: %w", ErrCorruptedState, err)
+		}
+
+		if key.Topic == name {
+			stored[string(data)] = len(value) != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, ok := range stored {
+		if !ok {
+			continue
+		}
+
+		if err := s.state.Put(ctx, []byte(key), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load restores states of queues from the state topic.
+func (s *Queues) load(ctx context.Context) error {
+	err := s.state.Load(ctx, func(data []byte, value []byte) error {
+		var key stateKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return fmt.Errorf("%w: %w", ErrCorruptedState, err)
+		}
+
+		id := queueKey{Topic: key.Topic, Partition: key.Partition}
+		q, ok := s.queues[id]
+
+		if len(value) == 0 {
+			// the cursor is deleted only with the topic.
+			if key.Offset == cursorOffset {
+				delete(s.queues, id)
+			} else if ok {
+				delete(q.messages, key.Offset)
+			}
+			return nil
+		}
+
+		if !ok {
+			q = s.newQueue(id, 0)
+			s.queues[id] = q
+		}
+
+		if key.Offset == cursorOffset {
+			var c cursor
+			if err := json.Unmarshal(value, &c); err != nil {
+				return fmt.Errorf("%w: %w", ErrCorruptedState, err)
+			}
+
+			q.floor = c.Floor
+			return nil
+		}
+
+		var m message
+		if err := json.Unmarshal(value, &m); err != nil {
+			return fmt.Errorf("%w: %w", ErrCorruptedState, err)
+		}
+
+		q.messages[key.Offset] = &m
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, q := range s.queues {
+		q.next = q.floor
+		for offset := range q.messages {
+			if offset < q.floor {
+				delete(q.messages, offset)
+				continue
+			}
+
+			q.next = max(q.next, offset+1)
+		}
+	}
+
+	return nil
+}
+
+// NewQueues loads states of queues, the state topic is created, if it does not exist.
+func NewQueues(ctx context.Context, logger *slog.Logger, topics *registry.Registry) (*Queues, error) {
+	state, err := compacted.Open(ctx, logger, topics, StateTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Queues{
+		logger: logger,
+		queues: make(map[queueKey]*queue),
+		topics: topics,
+		state:  state,
+		router: deadletter.NewRouter(logger, topics),
+	}
+
+	if err := s.load(ctx); err != nil {
+		logger.Error("failed to load states of queues", "err", err)
+		return nil, err
+	}
+
+	// states of topics, which were deleted without the hook finishing, are removed on start.
+	for key := range s.queues {
+		if _, err := topics.Config(key.Topic); !errors.Is(err, registry.ErrTopicNotFound) {
+			continue
+		}
+
+		if err := s.forget(ctx, key.Topic); err != nil {
+			logger.Error("failed to remove states of a deleted topic", "topic", key.Topic, "err", err)
+			return nil, err
+		}
+	}
+
+	topics.OnDelete(s.forget)
+
+	return s, nil
+}
@@ -0,0 +1,187 @@
+package registry
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+var (
+	ErrUnknownStrategy       = errors.New("unknown partitioning strategy")
+	ErrPartitionNotSpecified = errors.New("partition is not specified")
+)
+
+// Strategy is an algorithm, that chooses a partition for a record.
+type Strategy string
+
+const (
+	// Murmur2 sends records with the same key into the same partition, the same way Kafka does.
+	// Records without a key are partitioned by PartitionerConfig.KeylessStrategy.
+	Murmur2    Strategy = "murmur2"
+	RoundRobin Strategy = "round_robin"
+	// Sticky sends PartitionerConfig.StickyRecords records into a partition, before switching to another one.
+	Sticky Strategy = "sticky"
+	// Explicit requires the writer to choose the partition.
+	Explicit Strategy = "explicit"
+)
+
+const defaultStickyRecords = 64
+
+// PartitionerConfig chooses the partitioner of a topic, the zero value is Murmur2 with Sticky for records without a key.
+type PartitionerConfig struct {
+	Strategy        Strategy `json:"strategy"`
+	KeylessStrategy Strategy `json:"keyless_strategy"`
+	StickyRecords   int64    `json:"sticky_records"`
+}
+
+// Partitioner chooses a partition for a record, which is written into a topic with the amount of partitions.
+type Partitioner interface {
+	Partition(request topic.WriteIntoTopicRequest, partitions int64) (int64, error)
+}
+
+// IsHash reports whether the strategy maps keys to partitions,
+// such mapping changes when the amount of partitions changes.
+func (s Strategy) IsHash() bool {
+	return s == "" || s == Murmur2
+}
+
+func newPartitioner(config PartitionerConfig) (Partitioner, error) {
+	switch config.Strategy {
+	case "", Murmur2:
+		keyless := config
+		keyless.Strategy = config.KeylessStrategy
+		if keyless.Strategy == "" {
+			keyless.Strategy = Sticky
+		}
+
+		if !keyless.Strategy.isKeyless() {
+			return nil, ErrUnknownStrategy
+		}
+
+		fallback, err := newPartitioner(keyless)
+		if err != nil {
+			return nil, err
+		}
+
+		return &murmur2Partitioner{keyless: fallback}, nil
+	case RoundRobin:
+		return &roundRobinPartitioner{}, nil
+	case Sticky:
+		records := config.StickyRecords
+		if records <= 0 {
+			records = defaultStickyRecords
+		}
+
+		return &stickyPartitioner{records: records}, nil
+	case Explicit:
+		return explicitPartitioner{}, nil
+	}
+
+	return nil, ErrUnknownStrategy
+}
+
+func (s Strategy) isKeyless() bool {
+	return s == RoundRobin || s == Sticky
+}
+
+type murmur2Partitioner struct {
+	keyless Partitioner
+}
+
+func (p *murmur2Partitioner) Partition(request topic.WriteIntoTopicRequest, partitions int64) (int64, error) {
+	if request.Key == nil {
+		return p.keyless.Partition(request, partitions)
+	}
+
+	return int64(murmur2(request.Key)&0x7fffffff) % partitions, nil
+}
+
+type roundRobinPartitioner struct {
+	next atomic.Int64
+}
+
+func (p *roundRobinPartitioner) Partition(request topic.WriteIntoTopicRequest, partitions int64) (int64, error) {
+	return (p.next.Add(1) - 1) % partitions, nil
+}
+
+type stickyPartitioner struct {
+	mutex   sync.Mutex
+	records int64
+
+	current int64
+	left    int64
+}
+
+func (p *stickyPartitioner) Partition(request topic.WriteIntoTopicRequest, partitions int64) (int64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.left == 0 || p.current >= partitions {
+		next := rand.Int64N(partitions)
+		// switch to another partition, if there is one.
+		if partitions > 1 && next == p.current {
+			next = (next + 1) % partitions
+		}
+
+		p.current, p.left = next, p.records
+	}
+
+	p.left--
+
+	return p.current, nil
+}
+
+type explicitPartitioner struct{}
+
+func (explicitPartitioner) Partition(request topic.WriteIntoTopicRequest, partitions int64) (int64, error) {
+	if request.Partition == nil {
+		return 0, ErrPartitionNotSpecified
+	}
+
+	return *request.Partition, nil
+}
+
+// murmur2 is the hash function, which is used by the Kafka's default partitioner.
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return h
+}
@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+// kafkaVectors are results of murmur2 from the Kafka's test suite.
+var kafkaVectors = []struct {
+	key  string
+	hash int32
+	// partitions are the Kafka's partitions of the key for 3, 7 and 12 partitions.
+	partitions [3]int64
+}{
+	{"21", -973932308, [3]int64{0, 3, 0}},
+	{"foobar", -790332482, [3]int64{0, 0, 6}},
+	{"a-little-bit-long-string", -985981536, [3]int64{2, 1, 8}},
+	{"a-little-bit-longer-string", -1486304829, [3]int64{2, 0, 11}},
+	{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971, [3]int64{2, 3, 5}},
+	{"abc", 479470107, [3]int64{0, 4, 3}},
+}
+
+func TestMurmur2(t *testing.T) {
+	for _, v := range kafkaVectors {
+		if hash := int32(murmur2([]byte(v.key))); hash != v.hash {
+			t.Errorf("murmur2(%q) = %d, want %d", v.key, hash, v.hash)
+		}
+	}
+}
+
+func TestMurmur2Partitioner(t *testing.T) {
+	p, err := newPartitioner(PartitionerConfig{Strategy: Murmur2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range kafkaVectors {
+		for i, partitions := range []int64{3, 7, 12} {
+			got, err := p.Partition(topic.WriteIntoTopicRequest{Key: []byte(v.key)}, partitions)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != v.partitions[i] {
+				t.Errorf("partition of %q in %d partitions is %d, want %d", v.key, partitions, got, v.partitions[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,611 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/indigowar/dmq/internal/partition"
+	"github.com/indigowar/dmq/internal/partition/files"
+	"github.com/indigowar/dmq/internal/partition/index"
+	"github.com/indigowar/dmq/internal/partition/log"
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+var (
+	topicExt = "topic"
+)
+
+var (
+	ErrTopicNotFound      = errors.New("topic not found")
+	ErrTopicAlreadyExists = errors.New("topic already exists")
+	ErrInvalidTopicName   = errors.New("invalid topic name")
+	ErrInvalidConfig      = errors.New("invalid topic config")
+	ErrInternalTopic      = errors.New("topic is internal")
+	ErrReadOnly           = errors.New("registry is read-only")
+)
+
+// InternalPrefix starts names of internal topics, which can not be created or deleted by users.
+const InternalPrefix = "__"
+
+// validName restricts topic names to ones, which are safe to use as a directory name.
+var validName = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// Config is the configuration of a topic, Partition is applied to every partition of the topic.
+type Config struct {
+	Partitions  int64             `json:"partitions"`
+	Partitioner PartitionerConfig `json:"partitioner"`
+	Partition   partition.Config  `json:"partition"`
+	Queue       QueueConfig       `json:"queue"`
+	DeadLetter  DeadLetterConfig  `json:"dead_letter"`
+}
+
+// DeadLetterConfig chooses topics for records, which consumers have failed to process.
+// A failed record passes RetryTopics in order and then goes into the Topic.
+// Topics have to exist, when the topic is created. Retry topics have to be queue topics:
+// only queues apply the DeliveryDelay, a consumer group would read a retried record at once.
+type DeadLetterConfig struct {
+	Topic       string   `json:"topic,omitempty"`
+	RetryTopics []string `json:"retry_topics,omitempty"`
+}
+
+// QueueConfig enables the queue mode of a topic, where every record is delivered to one of competing consumers.
+type QueueConfig struct {
+	Enabled bool `json:"enabled"`
+	// VisibilityTimeout is the time a delivered record is hidden from other consumers, until it is acknowledged.
+	VisibilityTimeout time.Duration `json:"visibility_timeout"`
+	// MaxDeliveries is the amount of deliveries of a record, before it is moved into the dead letter topic,
+	// zero means unlimited.
+	MaxDeliveries int64 `json:"max_deliveries"`
+	// DeliveryDelay postpones the first delivery of a record, it is used by retry topics.
+	DeliveryDelay time.Duration `json:"delivery_delay,omitempty"`
+}
+
+// Description is a detailed state of a topic.
+type Description struct {
+	Name       string                 `json:"name"`
+	Config     Config                 `json:"config"`
+	Partitions []PartitionDescription `json:"partitions"`
+}
+
+type PartitionDescription struct {
+	Number        int64 `json:"number"`
+	HighWatermark int64 `json:"high_watermark"`
+}
+
+type entry struct {
+	Name   string `json:"name"`
+	Config Config `json:"config"`
+	// Epoch is incremented, when partitions are added, PreviousPartitions is the amount of partitions before that.
+	Epoch              int64 `json:"epoch"`
+	PreviousPartitions int64 `json:"previous_partitions,omitempty"`
+
+	// adding serializes additions of partitions, they are created without the registry's lock.
+	adding sync.Mutex
+
+	manager     *partition.Manager
+	partitioner Partitioner
+}
+
+// DeleteHook is called with the name of a deleted topic, before a topic with the same name can be created.
+type DeleteHook func(ctx context.Context, name string) error
+
+// Registry maps names of topics to their partitions,
+// every topic is stored in its own directory.
+type Registry struct {
+	logger *slog.Logger
+
+	mutex  sync.RWMutex
+	topics map[string]*entry
+	// deleted are called after a topic is deleted, they clear states, which are stored by the topic's name.
+	deleted []DeleteHook
+
+	path string
+	// readOnly registry does not change topics and does not recover their files.
+	readOnly bool
+
+	index index.Index
+	log   log.Log
+	files *files.Cache
+}
+
+// Create creates a topic with config.Partitions partitions.
+func (r *Registry) Create(ctx context.Context, name string, config Config) (topic.Topic, error) {
+	if strings.HasPrefix(name, InternalPrefix) {
+		return topic.Topic{}, fmt.Errorf("%w: %q", ErrInternalTopic, name)
+	}
+
+	return r.add(ctx, name, config)
+}
+
+// CreateInternal creates an internal topic, its name must start with the InternalPrefix.
+func (r *Registry) CreateInternal(ctx context.Context, name string, config Config) (topic.Topic, error) {
+	if !strings.HasPrefix(name, InternalPrefix) {
+		return topic.Topic{}, fmt.Errorf("%w: %q is not internal", ErrInvalidTopicName, name)
+	}
+
+	return r.add(ctx, name, config)
+}
+
+func (r *Registry) add(ctx context.Context, name string, config Config) (topic.Topic, error) {
+	if r.readOnly {
+		return topic.Topic{}, ErrReadOnly
+	}
+
+	if !validName.MatchString(name) || name == "." || name == ".." {
+		return topic.Topic{}, fmt.Errorf("%w: %q", ErrInvalidTopicName, name)
+	}
+
+	if config.Partitions < 1 {
+		return topic.Topic{}, fmt.Errorf("%w: topic needs at least one partition", ErrInvalidConfig)
+	}
+
+	partitioner, err := newPartitioner(config.Partitioner)
+	if err != nil {
+		return topic.Topic{}, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.topics[name]; ok {
+		return topic.Topic{}, ErrTopicAlreadyExists
+	}
+
+	if err := r.validateDeadLetter(config.DeadLetter); err != nil {
+		return topic.Topic{}, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	if _, err := os.Stat(r.topicPath(name)); err == nil {
+		return topic.Topic{}, ErrTopicAlreadyExists
+	}
+
+	e := &entry{Name: name, Config: config, partitioner: partitioner}
+	if err := r.create(ctx, e); err != nil {
+		r.logger.Error("failed to create a topic", "topic", name, "err", err)
+		if err := os.RemoveAll(r.topicPath(name)); err != nil {
+			r.logger.Warn("failed to clean up a topic", "topic", name, "err", err)
+		}
+
+		return topic.Topic{}, err
+	}
+
+	r.topics[name] = e
+
+	r.logger.Info("created a topic", "topic", name, "partitions", config.Partitions)
+
+	return e.topic(), nil
+}
+
+// validateDeadLetter checks, that topics of the config exist and retry topics are queues.
+// It is called under the lock.
+func (r *Registry) validateDeadLetter(config DeadLetterConfig) error {
+	for _, name := range config.RetryTopics {
+		e, ok := r.topics[name]
+		if !ok {
+			return fmt.Errorf("retry topic %q: %w", name, ErrTopicNotFound)
+		}
+
+		if !e.Config.Queue.Enabled {
+			return fmt.Errorf("retry topic %q is not a queue", name)
+		}
+	}
+
+	if _, ok := r.topics[config.Topic]; config.Topic != "" && !ok {
+		return fmt.Errorf("dead letter topic %q: %w", config.Topic, ErrTopicNotFound)
+	}
+
+	return nil
+}
+
+func (r *Registry) create(ctx context.Context, e *entry) error {
+	manager, err := partition.NewManager(r.logger, r.topicPath(e.Name), e.Config.Partition, r.index, r.log, r.files)
+	if err != nil {
+		return err
+	}
+
+	for i := int64(0); i != e.Config.Partitions; i++ {
+		if _, err := manager.CreatePartition(ctx, topic.NewPartitionRequest{}); err != nil {
+			return err
+		}
+	}
+
+	e.manager = manager
+
+	return r.dump(e)
+}
+
+// Config returns the configuration of the topic.
+func (r *Registry) Config(name string) (Config, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	e, ok := r.topics[name]
+	if !ok {
+		return Config{}, ErrTopicNotFound
+	}
+
+	return e.Config, nil
+}
+
+// Write writes the record into a partition of the topic, which is chosen by the topic's partitioner.
+func (r *Registry) Write(ctx context.Context, request topic.WriteIntoTopicRequest) (topic.WriteIntoTopicResponse, error) {
+	e, route, err := r.route(request)
+	if err != nil {
+		return topic.WriteIntoTopicResponse{}, err
+	}
+
+	response, err := e.manager.Write(ctx, topic.WriteIntoPartitionRequest{
+		Partition: route.Partition,
+		Key:       request.Key,
+		Value:     request.Value,
+		Headers:   request.Headers,
+		Timestamp: request.Timestamp,
+		ExpiresAt: request.ExpiresAt,
+	})
+	if err != nil {
+		return topic.WriteIntoTopicResponse{}, err
+	}
+
+	route.Offset, route.Timestamp = response.Offset, response.Timestamp
+
+	return route, nil
+}
+
+// Route returns the partition, which the topic's partitioner chooses for the request.
+func (r *Registry) Route(request topic.WriteIntoTopicRequest) (int64, error) {
+	_, route, err := r.route(request)
+	if err != nil {
+		return 0, err
+	}
+
+	return route.Partition, nil
+}
+
+// route chooses a partition for the request with the amount of partitions of the topic's epoch,
+// partitions, which are being added, are not used until the epoch changes.
+func (r *Registry) route(request topic.WriteIntoTopicRequest) (*entry, topic.WriteIntoTopicResponse, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	e, ok := r.topics[request.Topic]
+	if !ok {
+		return nil, topic.WriteIntoTopicResponse{}, ErrTopicNotFound
+	}
+
+	number, err := e.partition(request)
+	if err != nil {
+		return nil, topic.WriteIntoTopicResponse{}, err
+	}
+
+	return e, topic.WriteIntoTopicResponse{
+		Partition: number,
+		Epoch:     e.Epoch,
+		Warning:   e.moved(request, number),
+	}, nil
+}
+
+// List returns all topics ordered by name.
+func (r *Registry) List() []topic.Topic {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	topics := make([]topic.Topic, 0, len(r.topics))
+	for _, e := range r.topics {
+		topics = append(topics, e.topic())
+	}
+
+	slices.SortFunc(topics, func(a, b topic.Topic) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return topics
+}
+
+func (r *Registry) Describe(ctx context.Context, name string) (Description, error) {
+	r.mutex.RLock()
+	e, ok := r.topics[name]
+	if !ok {
+		r.mutex.RUnlock()
+		return Description{}, ErrTopicNotFound
+	}
+
+	description := Description{
+		Name:       e.Name,
+		Config:     e.Config,
+		Partitions: []PartitionDescription{},
+	}
+	r.mutex.RUnlock()
+
+	for _, number := range e.manager.Partitions() {
+		response, err := e.manager.HighWatermark(ctx, topic.HighWatermarkRequest{Partition: number})
+		if err != nil {
+			return Description{}, err
+		}
+
+		description.Partitions = append(description.Partitions, PartitionDescription{
+			Number:        number,
+			HighWatermark: response.NextOffset,
+		})
+	}
+
+	return description, nil
+}
+
+// AddPartitions adds partitions to the topic, while it is being used.
+// Existing records stay in their partitions, but keys of new records may be mapped to other partitions.
+func (r *Registry) AddPartitions(ctx context.Context, request topic.AddPartitionsRequest) (topic.AddPartitionsResponse, error) {
+	if r.readOnly {
+		return topic.AddPartitionsResponse{}, ErrReadOnly
+	}
+
+	if request.Count < 1 {
+		return topic.AddPartitionsResponse{}, fmt.Errorf("%w: at least one partition must be added", ErrInvalidConfig)
+	}
+
+	e, err := r.get(request.Topic)
+	if err != nil {
+		return topic.AddPartitionsResponse{}, err
+	}
+
+	e.adding.Lock()
+	defer e.adding.Unlock()
+
+	// partitions are created without the registry's lock, so other topics are not blocked by the file system.
+	created := e.manager.Len()
+	for i := int64(0); i != request.Count && err == nil; i++ {
+		_, err = e.manager.CreatePartition(ctx, topic.NewPartitionRequest{})
+	}
+	created = e.manager.Len() - created
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if created != 0 {
+		// the metadata reflects the partitions, which were created, even if some of them failed.
+		e.PreviousPartitions, e.Epoch = e.Config.Partitions, e.Epoch+1
+		e.Config.Partitions += created
+	}
+
+	if err := errors.Join(err, r.dump(e)); err != nil {
+		r.logger.Error("failed to add partitions", "topic", request.Topic, "partitions", e.Config.Partitions, "err", err)
+		return topic.AddPartitionsResponse{}, err
+	}
+
+	response := topic.AddPartitionsResponse{Partitions: e.Config.Partitions, Epoch: e.Epoch}
+	if e.Config.Partitioner.Strategy.IsHash() {
+		response.Warning = fmt.Sprintf("topic %q is partitioned by a key hash: new records with the same key may be written into another partition", request.Topic)
+		r.logger.Warn("key to partition mapping has changed", "topic", request.Topic, "partitions", e.Config.Partitions)
+	}
+
+	r.logger.Info("added partitions", "topic", request.Topic, "partitions", e.Config.Partitions, "epoch", e.Epoch)
+
+	return response, nil
+}
+
+// Delete removes the topic with all of its records.
+// The directory of the topic is removed after delete hooks, so the topic can not be created again before they finish.
+func (r *Registry) Delete(ctx context.Context, name string) error {
+	if r.readOnly {
+		return ErrReadOnly
+	}
+
+	if strings.HasPrefix(name, InternalPrefix) {
+		return fmt.Errorf("%w: %q", ErrInternalTopic, name)
+	}
+
+	e, err := r.get(name)
+	if err != nil {
+		return err
+	}
+
+	// partitions, which are being added, are created before the topic is deleted.
+	e.adding.Lock()
+	defer e.adding.Unlock()
+
+	r.mutex.Lock()
+	if r.topics[name] != e {
+		r.mutex.Unlock()
+		return ErrTopicNotFound
+	}
+
+	delete(r.topics, name)
+	hooks := r.deleted
+
+	r.logger.Info("deleting a topic", "topic", name)
+
+	// without the metadata the directory is skipped on start, even if it is not removed.
+	errs := []error{e.manager.Delete(ctx), os.Remove(r.metadataPath(name))}
+	r.mutex.Unlock()
+
+	for _, hook := range hooks {
+		if err := hook(ctx, name); err != nil {
+			r.logger.Error("a delete hook has failed", "topic", name, "err", err)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(append(errs, os.RemoveAll(r.topicPath(name)))...)
+}
+
+// OnDelete adds the hook, which is called after every deletion of a topic.
+func (r *Registry) OnDelete(hook DeleteHook) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.deleted = append(r.deleted, hook)
+}
+
+// Partitions returns the manager of the topic's partitions.
+func (r *Registry) Partitions(name string) (*partition.Manager, error) {
+	e, err := r.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.manager, nil
+}
+
+func (r *Registry) get(name string) (*entry, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	e, ok := r.topics[name]
+	if !ok {
+		return nil, ErrTopicNotFound
+	}
+
+	return e, nil
+}
+
+func (r *Registry) load(name string) (*entry, error) {
+	// a temporary file is left by an interrupted dump, the metadata itself is either old or new.
+	if !r.readOnly {
+		if err := os.Remove(r.metadataPath(name) + files.TempExt); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(r.metadataPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+
+	e.partitioner, err = newPartitioner(e.Config.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.readOnly {
+		e.manager, err = partition.NewReadOnlyManager(r.logger, r.topicPath(name), e.Config.Partition, r.index, r.log, r.files)
+	} else {
+		e.manager, err = partition.NewManager(r.logger, r.topicPath(name), e.Config.Partition, r.index, r.log, r.files)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// partitions may be added without updating the metadata, if adding failed.
+	if partitions := e.manager.Len(); partitions != e.Config.Partitions {
+		e.PreviousPartitions, e.Epoch = e.Config.Partitions, e.Epoch+1
+		e.Config.Partitions = partitions
+	}
+
+	return e, nil
+}
+
+// dump replaces the metadata atomically, so a crash does not leave a truncated file, which fails the start.
+func (r *Registry) dump(e *entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return files.WriteFile(r.metadataPath(e.Name), append(data, '\n'))
+}
+
+func (r *Registry) topicPath(name string) string {
+	return fmt.Sprintf("%s/%s", r.path, name)
+}
+
+func (r *Registry) metadataPath(name string) string {
+	return fmt.Sprintf("%s/%s/%s.%s", r.path, name, name, topicExt)
+}
+
+// partition chooses a partition for the request, an explicitly requested partition is always used.
+func (e *entry) partition(request topic.WriteIntoTopicRequest) (int64, error) {
+	if request.Partition != nil {
+		return *request.Partition, nil
+	}
+
+	return e.partitioner.Partition(request, e.Config.Partitions)
+}
+
+// moved returns a warning, when the key of the request was mapped to another partition in the previous epoch,
+// records of such keys are not ordered across the epochs.
+func (e *entry) moved(request topic.WriteIntoTopicRequest, number int64) string {
+	if request.Partition != nil || request.Key == nil || e.PreviousPartitions == 0 || !e.Config.Partitioner.Strategy.IsHash() {
+		return ""
+	}
+
+	previous, err := e.partitioner.Partition(request, e.PreviousPartitions)
+	if err != nil || previous == number {
+		return ""
+	}
+
+	return fmt.Sprintf("partitions of topic %q were added in the epoch %d: the key was written into the partition %d before", e.Name, e.Epoch, previous)
+}
+
+func (e *entry) topic() topic.Topic {
+	return topic.Topic{
+		Name:       e.Name,
+		Partitions: e.Config.Partitions,
+	}
+}
+
+// NewRegistry loads all topics from the data directory.
+func NewRegistry(logger *slog.Logger, path string, index index.Index, log log.Log, files *files.Cache) (*Registry, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+
+	return openRegistry(logger, path, false, index, log, files)
+}
+
+// NewReadOnlyRegistry loads all topics from the data directory, so they can be inspected,
+// while a broker may be running on the same directory: topics can not be changed and their files are not recovered.
+// Records must not be written into them.
+func NewReadOnlyRegistry(logger *slog.Logger, path string, index index.Index, log log.Log, files *files.Cache) (*Registry, error) {
+	return openRegistry(logger, path, true, index, log, files)
+}
+
+func openRegistry(logger *slog.Logger, path string, readOnly bool, index index.Index, log log.Log, files *files.Cache) (*Registry, error) {
+	r := &Registry{
+		logger:   logger,
+		topics:   make(map[string]*entry),
+		path:     path,
+		readOnly: readOnly,
+		index:    index,
+		log:      log,
+		files:    files,
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range entries {
+		if !dir.IsDir() {
+			continue
+		}
+
+		e, err := r.load(dir.Name())
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				logger.Warn("skipping a directory without a topic", "directory", dir.Name())
+				continue
+			}
+
+			logger.Error("failed to load a topic", "topic", dir.Name(), "err", err)
+			return nil, err
+		}
+
+		r.topics[e.Name] = e
+	}
+
+	return r, nil
+}
@@ -0,0 +1,66 @@
+package schedule
+
+import (
+	"time"
+
+	"github.com/indigowar/dmq/internal/core/record"
+)
+
+type State string
+
+const (
+	// Pending schedule waits for its delivery time.
+	Pending State = "pending"
+	// Delivering schedule may be already written into the target partition,
+	// it has to be checked before the record is written again.
+	Delivering State = "delivering"
+	// Failed schedule can not be delivered, its Reason tells why.
+	Failed State = "failed"
+)
+
+// schedule is a value of the schedules topic, the key is the id of the schedule.
+type schedule struct {
+	State     State           `json:"state"`
+	Topic     string          `json:"topic"`
+	Partition *int64          `json:"partition,omitempty"`
+	Key       []byte          `json:"key,omitempty"`
+	Value     []byte          `json:"value"`
+	Headers   []record.Header `json:"headers,omitempty"`
+	DeliverAt time.Time       `json:"deliver_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+
+	// Target is the partition, the record is written into, Watermark is its high watermark before the write.
+	Target    int64 `json:"target,omitempty"`
+	Watermark int64 `json:"watermark,omitempty"`
+
+	Reason string `json:"reason,omitempty"`
+}
+
+// entry is a schedule, which is not done yet. Only the place of the schedule in the schedules topic is kept in memory,
+// the schedule is read, when it is delivered.
+type entry struct {
+	state     State
+	offset    int64
+	deliverAt time.Time
+}
+
+type item struct {
+	id string
+	at time.Time
+}
+
+// timeline is a min-heap of schedules ordered by their delivery time.
+type timeline []item
+
+func (t timeline) Len() int           { return len(t) }
+func (t timeline) Less(i, j int) bool { return t[i].at.Before(t[j].at) }
+func (t timeline) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+func (t *timeline) Push(x any) { *t = append(*t, x.(item)) }
+
+func (t *timeline) Pop() any {
+	old := *t
+	last := old[len(old)-1]
+	*t = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,467 @@
+package schedule
+
+import (
+	"container/heap"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/indigowar/dmq/internal/compacted"
+	"github.com/indigowar/dmq/internal/core/record"
+	"github.com/indigowar/dmq/internal/partition"
+	"github.com/indigowar/dmq/internal/registry"
+	"github.com/indigowar/dmq/internal/topic"
+)
+
+// SchedulesTopic is the internal topic, which stores pending schedules.
+// Timestamps of its records are delivery times of the schedules.
+const SchedulesTopic = "__scheduled"
+
+// HeaderScheduleID is added to every delivered record, it identifies the schedule of the record.
+const HeaderScheduleID = "dmq-schedule-id"
+
+var (
+	ErrUnknownSchedule    = errors.New("schedule does not exist or is already delivered")
+	ErrPartitionNotFound  = errors.New("partition does not exist")
+	ErrCorruptedSchedule  = errors.New("corrupted schedule")
+	ErrInvalidDeliverTime = errors.New("invalid delivery time")
+)
+
+// retryDelay is the time between failed attempts to deliver a record.
+const retryDelay = time.Second
+
+// deliveredChunk is the maximum amount of records, which are read at once to find a delivered record.
+const deliveredChunk = 256
+
+// failedRetention is the time a failed schedule is kept in the schedules topic, before it expires.
+const failedRetention = 7 * 24 * time.Hour
+
+// Scheduler writes scheduled records into their topics, when their delivery time arrives.
+// Each record is delivered once: the target partition is stored before the write,
+// so a write interrupted by a restart is found in the partition instead of being repeated.
+type Scheduler struct {
+	logger *slog.Logger
+
+	mutex    sync.Mutex
+	pending  map[string]entry
+	timeline timeline
+	wake     chan struct{}
+	// delivering is the id of the schedule, which is being delivered without the mutex.
+	delivering string
+
+	topics    *registry.Registry
+	schedules *compacted.Log
+}
+
+// Schedule stores the record until its delivery time.
+func (s *Scheduler) Schedule(ctx context.Context, request topic.ScheduleRequest) (topic.ScheduleResponse, error) {
+	if request.DeliverAt.IsZero() {
+		return topic.ScheduleResponse{}, ErrInvalidDeliverTime
+	}
+
+	config, err := s.topics.Config(request.Topic)
+	if err != nil {
+		return topic.ScheduleResponse{}, err
+	}
+
+	if request.Partition != nil && (*request.Partition < 0 || *request.Partition >= config.Partitions) {
+		return topic.ScheduleResponse{}, ErrPartitionNotFound
+	}
+
+	sc := &schedule{
+		State:     Pending,
+		Topic:     request.Topic,
+		Partition: request.Partition,
+		Key:       request.Key,
+		Value:     request.Value,
+		Headers:   request.Headers,
+		DeliverAt: request.DeliverAt,
+		ExpiresAt: request.ExpiresAt,
+	}
+	id := newScheduleID()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	offset, err := s.store(ctx, id, sc)
+	if err != nil {
+		return topic.ScheduleResponse{}, err
+	}
+
+	s.pending[id] = entry{state: Pending, offset: offset, deliverAt: sc.DeliverAt}
+	heap.Push(&s.timeline, item{id: id, at: sc.DeliverAt})
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return topic.ScheduleResponse{ID: id, DeliverAt: sc.DeliverAt}, nil
+}
+
+// Cancel removes the schedule, which is not delivered yet.
+func (s *Scheduler) Cancel(ctx context.Context, request topic.CancelScheduleRequest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.pending[request.ID]
+	if !ok || e.state != Pending || request.ID == s.delivering {
+		return ErrUnknownSchedule
+	}
+
+	if err := s.schedules.Put(ctx, []byte(request.ID), nil); err != nil {
+		return err
+	}
+
+	// the item stays in the timeline and is skipped, when it is due.
+	delete(s.pending, request.ID)
+	return nil
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.mutex.Lock()
+		wait := time.Hour
+		if len(s.timeline) != 0 {
+			wait = time.Until(s.timeline[0].at)
+		}
+		s.mutex.Unlock()
+
+		if wait > 0 {
+			// the timer is drained, so a fire of the previous wait is not taken for this one.
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+				continue
+			case <-timer.C:
+			}
+		}
+
+		s.deliverDue(ctx)
+	}
+}
+
+func (s *Scheduler) deliverDue(ctx context.Context) {
+	for _, id := range s.due(time.Now()) {
+		e, ok := s.take(id)
+		if !ok {
+			continue
+		}
+
+		sc, err := s.read(ctx, e)
+		if err == nil {
+			err = s.deliver(ctx, id, sc)
+			if err != nil && ctx.Err() == nil && terminal(err) {
+				err = s.fail(ctx, id, sc, err)
+			}
+		}
+
+		s.mutex.Lock()
+		s.delivering = ""
+		if err != nil && ctx.Err() == nil {
+			s.logger.Warn("failed to deliver a scheduled record", "id", id, "topic", sc.Topic, "err", err)
+			heap.Push(&s.timeline, item{id: id, at: time.Now().Add(retryDelay)})
+		}
+		s.mutex.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// due removes schedules, which are due at the time, from the timeline and returns their ids.
+func (s *Scheduler) due(now time.Time) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ids []string
+	for len(s.timeline) != 0 && !s.timeline[0].at.After(now) {
+		ids = append(ids, heap.Pop(&s.timeline).(item).id)
+	}
+
+	return ids
+}
+
+// take returns the pending schedule and marks it as being delivered, so it can not be cancelled.
+func (s *Scheduler) take(id string) (entry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.pending[id]
+	if !ok {
+		return entry{}, false
+	}
+
+	s.delivering = id
+	return e, true
+}
+
+// read reads the schedule from the schedules topic.
+func (s *Scheduler) read(ctx context.Context, e entry) (schedule, error) {
+	r, err := s.schedules.Read(ctx, e.offset)
+	if err != nil {
+		return schedule{}, err
+	}
+
+	var sc schedule
+	if err := json.Unmarshal(r.Value, &sc); err != nil {
+		return schedule{}, fmt.Errorf("%w: %w", ErrCorruptedSchedule, err)
+	}
+
+	return sc, nil
+}
+
+// terminal reports, whether the delivery fails the same way, when it is repeated.
+func terminal(err error) bool {
+	return errors.Is(err, registry.ErrTopicNotFound) ||
+		errors.Is(err, ErrPartitionNotFound) ||
+		errors.Is(err, partition.ErrPartitionNotFound) ||
+		errors.Is(err, partition.ErrRecordTooLarge) ||
+		errors.Is(err, partition.ErrBatchTooLarge) ||
+		errors.Is(err, partition.ErrInvalidExpiry)
+}
+
+// deliver writes the record into its topic, if it is not there yet, and removes the schedule.
+func (s *Scheduler) deliver(ctx context.Context, id string, sc schedule) error {
+	partitions, err := s.topics.Partitions(sc.Topic)
+	if err != nil {
+		return err
+	}
+
+	if sc.State == Delivering {
+		delivered, err := s.delivered(ctx, id, sc, partitions)
+		if err != nil {
+			return err
+		}
+
+		if delivered {
+			return s.complete(ctx, id)
+		}
+	} else {
+		target, err := s.target(sc)
+		if err != nil {
+			return err
+		}
+
+		watermark, err := partitions.HighWatermark(ctx, topic.HighWatermarkRequest{Partition: target})
+		if err != nil {
+			return err
+		}
+
+		sc.State, sc.Target, sc.Watermark = Delivering, target, watermark.NextOffset
+		offset, err := s.store(ctx, id, &sc)
+		if err != nil {
+			return err
+		}
+
+		s.mutex.Lock()
+		s.pending[id] = entry{state: Delivering, offset: offset, deliverAt: sc.DeliverAt}
+		s.mutex.Unlock()
+	}
+
+	headers := append(slices.Clone(sc.Headers), record.Header{Key: HeaderScheduleID, Value: []byte(id)})
+	if _, err := s.topics.Write(ctx, topic.WriteIntoTopicRequest{
+		Topic:     sc.Topic,
+		Partition: &sc.Target,
+		Key:       sc.Key,
+		Value:     sc.Value,
+		Headers:   headers,
+		ExpiresAt: sc.ExpiresAt,
+	}); err != nil {
+		return err
+	}
+
+	s.logger.Debug("delivered a scheduled record", "id", id, "topic", sc.Topic, "partition", sc.Target)
+
+	return s.complete(ctx, id)
+}
+
+// fail stops deliveries of the schedule, it is kept in the schedules topic with the reason of the failure,
+// until it expires after the failedRetention.
+func (s *Scheduler) fail(ctx context.Context, id string, sc schedule, cause error) error {
+	sc.State, sc.Reason = Failed, cause.Error()
+	if _, err := s.storeUntil(ctx, id, &sc, laterOf(time.Now(), sc.DeliverAt).Add(failedRetention)); err != nil {
+		return err
+	}
+
+	s.logger.Error("dropped a scheduled record, which can not be delivered", "id", id, "topic", sc.Topic, "err", cause)
+
+	s.mutex.Lock()
+	delete(s.pending, id)
+	s.mutex.Unlock()
+
+	return nil
+}
+
+func (s *Scheduler) target(sc schedule) (int64, error) {
+	if sc.Partition != nil {
+		return *sc.Partition, nil
+	}
+
+	return s.topics.Route(topic.WriteIntoTopicRequest{Topic: sc.Topic, Key: sc.Key, Value: sc.Value, Headers: sc.Headers})
+}
+
+// delivered checks, whether records written after the watermark contain the record of the schedule.
+// Records are read in chunks, so a long range is not read into memory at once.
+func (s *Scheduler) delivered(ctx context.Context, id string, sc schedule, partitions *partition.Manager) (bool, error) {
+	watermark, err := partitions.HighWatermark(ctx, topic.HighWatermarkRequest{Partition: sc.Target})
+	if err != nil {
+		return false, err
+	}
+
+	for offset := sc.Watermark; offset < watermark.NextOffset; {
+		response, err := partitions.ReadRange(ctx, topic.ReadRangeFromPartitionRequest{
+			Partition: sc.Target,
+			Offset:    offset,
+			Count:     min(watermark.NextOffset-offset, deliveredChunk),
+			// the delivered record may expire before it is searched.
+			IncludeExpired: true,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		for _, r := range response.Records {
+			for _, h := range r.Headers {
+				if h.Key == HeaderScheduleID && string(h.Value) == id {
+					return true, nil
+				}
+			}
+		}
+
+		if response.NextOffset <= offset {
+			break
+		}
+		offset = response.NextOffset
+	}
+
+	return false, nil
+}
+
+func (s *Scheduler) complete(ctx context.Context, id string) error {
+	if err := s.schedules.Put(ctx, []byte(id), nil); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	delete(s.pending, id)
+	s.mutex.Unlock()
+
+	return nil
+}
+
+// store writes the schedule and returns its offset in the schedules topic.
+func (s *Scheduler) store(ctx context.Context, id string, sc *schedule) (int64, error) {
+	return s.storeUntil(ctx, id, sc, time.Time{})
+}
+
+// storeUntil writes the schedule, which expires at the time, zero time means never.
+func (s *Scheduler) storeUntil(ctx context.Context, id string, sc *schedule, expiresAt time.Time) (int64, error) {
+	data, err := json.Marshal(sc)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.schedules.Write(ctx, topic.WriteIntoPartitionRequest{
+		Key:       []byte(id),
+		Value:     data,
+		Timestamp: sc.DeliverAt,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func laterOf(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
+
+// load restores pending schedules from the schedules topic, records are decoded one by one
+// and only their offsets are kept, so payloads of schedules are not held in memory.
+func (s *Scheduler) load(ctx context.Context) error {
+	err := s.schedules.Scan(ctx, func(r topic.ReadFromPartitionResponse) error {
+		id := string(r.Key)
+		if len(r.Value) == 0 {
+			delete(s.pending, id)
+			return nil
+		}
+
+		var sc schedule
+		if err := json.Unmarshal(r.Value, &sc); err != nil {
+			return fmt.Errorf("%w: %w", ErrCorruptedSchedule, err)
+		}
+
+		if sc.State == Failed {
+			delete(s.pending, id)
+			return nil
+		}
+
+		s.pending[id] = entry{state: sc.State, offset: r.Offset, deliverAt: sc.DeliverAt}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for id, e := range s.pending {
+		s.timeline = append(s.timeline, item{id: id, at: e.deliverAt})
+	}
+	heap.Init(&s.timeline)
+
+	return nil
+}
+
+func newScheduleID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return "schedule-" + hex.EncodeToString(id)
+}
+
+// NewScheduler loads pending schedules and delivers them until the ctx is done,
+// the schedules topic is created, if it does not exist.
+func NewScheduler(ctx context.Context, logger *slog.Logger, topics *registry.Registry) (*Scheduler, error) {
+	schedules, err := compacted.OpenWithConfig(ctx, logger, topics, SchedulesTopic, partition.Config{TimestampType: record.CreateTime})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scheduler{
+		logger:    logger,
+		pending:   make(map[string]entry),
+		wake:      make(chan struct{}, 1),
+		topics:    topics,
+		schedules: schedules,
+	}
+
+	if err := s.load(ctx); err != nil {
+		logger.Error("failed to load schedules", "err", err)
+		return nil, err
+	}
+
+	go s.run(ctx)
+
+	return s, nil
+}
@@ -1,6 +1,10 @@
 package topic
 
-import "time"
+import (
+	"time"
+
+	"github.com/indigowar/dmq/internal/core/record"
+)
 
 // NewPartitionRequest - is used to request a creation of a new partition
 type NewPartitionRequest = struct{}
@@ -13,9 +17,13 @@ type NewPartitionResponse struct {
 
 // WriteIntoPartitionRequest - is used to request write operation into a partition
 type WriteIntoPartitionRequest struct {
-	Partition int64  `json:"partition"`
-	Key       []byte `json:"key,omitempty"`
-	Value     []byte `json:"value"`
+	Partition int64           `json:"partition"`
+	Key       []byte          `json:"key,omitempty"`
+	Value     []byte          `json:"value"`
+	Headers   []record.Header `json:"headers,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	// ExpiresAt is the time, after which the record is not delivered, zero value means never.
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // WriteIntoPartitionResponse - is used as a return value for [WriteIntoPartitionRequest]
@@ -35,8 +43,367 @@ type ReadByTimestampFromPartitionRequest struct {
 }
 
 type ReadFromPartitionResponse struct {
+	Offset    int64           `json:"offset"`
+	Timestamp time.Time       `json:"timestamp"`
+	Key       []byte          `json:"key,omitempty"`
+	Value     []byte          `json:"value"`
+	Headers   []record.Header `json:"headers,omitempty"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// WaitForPartitionRequest - is used to wait for new records in a partition,
+// without polling it.
+type WaitForPartitionRequest struct {
+	Partition  int64         `json:"partition"`
+	Offset     int64         `json:"offset"`
+	MinRecords int64         `json:"min_records"`
+	MaxWait    time.Duration `json:"max_wait"`
+}
+
+// WaitForPartitionResponse - is used as a return value for [WaitForPartitionRequest],
+// Available is the amount of records at or beyond the requested offset.
+type WaitForPartitionResponse struct {
+	NextOffset int64 `json:"next_offset"`
+	Available  int64 `json:"available"`
+}
+
+// HighWatermarkRequest - is used to request the offset of the next record in a partition
+type HighWatermarkRequest struct {
+	Partition int64 `json:"partition"`
+}
+
+// HighWatermarkResponse - is used as a return value for [HighWatermarkRequest],
+// HeadTimestamp is the maximum timestamp of records in the partition.
+type HighWatermarkResponse struct {
+	NextOffset    int64     `json:"next_offset"`
+	HeadTimestamp time.Time `json:"head_timestamp"`
+}
+
+// OffsetTimestampRequest - is used to request the timestamp of the Offset in a partition from its timestamp index
+type OffsetTimestampRequest struct {
+	Partition int64 `json:"partition"`
+	Offset    int64 `json:"offset"`
+}
+
+// OffsetTimestampResponse - is used as a return value for [OffsetTimestampRequest],
+// Timestamp is the maximum timestamp of records up to the batch, which contains the offset.
+type OffsetTimestampResponse struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ReadLatestFromPartitionRequest - is used to request the last record in a partition
+type ReadLatestFromPartitionRequest struct {
+	Partition int64 `json:"partition"`
+}
+
+// TailPartitionRequest - is used to request the last Count records in a partition
+type TailPartitionRequest struct {
+	Partition int64 `json:"partition"`
+	Count     int64 `json:"count"`
+}
+
+// TailPartitionResponse - is used as a return value for [TailPartitionRequest],
+// Records are ordered by offset.
+type TailPartitionResponse struct {
+	Records []ReadFromPartitionResponse `json:"records"`
+}
+
+// ReadRangeFromPartitionRequest - is used to request up to Count records in a partition,
+// starting at the Offset
+type ReadRangeFromPartitionRequest struct {
+	Partition int64 `json:"partition"`
+	Offset    int64 `json:"offset"`
+	Count     int64 `json:"count"`
+	// IncludeExpired returns expired records as well, they are skipped by default.
+	IncludeExpired bool `json:"include_expired,omitempty"`
+}
+
+// ReadRangeFromPartitionResponse - is used as a return value for [ReadRangeFromPartitionRequest],
+// Records are ordered by offset and never go beyond the high watermark.
+type ReadRangeFromPartitionResponse struct {
+	Records []ReadFromPartitionResponse `json:"records"`
+	// NextOffset is the offset after the range, expired records may leave the range without Records.
+	NextOffset int64 `json:"next_offset"`
+}
+
+// WriteIntoTopicRequest - is used to request write operation into a topic,
+// the partition is chosen by the topic's partitioner, unless Partition is set.
+type WriteIntoTopicRequest struct {
+	Topic     string          `json:"topic"`
+	Partition *int64          `json:"partition,omitempty"`
+	Key       []byte          `json:"key,omitempty"`
+	Value     []byte          `json:"value"`
+	Headers   []record.Header `json:"headers,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	// ExpiresAt is the time, after which the record is not delivered, zero value means never.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WriteIntoTopicResponse - is used as a return value for [WriteIntoTopicRequest],
+// Epoch of the topic changes, when partitions are added.
+// Warning is set, when the key was mapped to another partition in the previous epoch.
+type WriteIntoTopicResponse struct {
+	Partition int64     `json:"partition"`
 	Offset    int64     `json:"offset"`
 	Timestamp time.Time `json:"timestamp"`
-	Key       []byte    `json:"key,omitempty"`
-	Value     []byte    `json:"value"`
+	Epoch     int64     `json:"epoch"`
+	Warning   string    `json:"warning,omitempty"`
+}
+
+// AddPartitionsRequest - is used to add Count partitions to a topic
+type AddPartitionsRequest struct {
+	Topic string `json:"topic"`
+	Count int64  `json:"count"`
+}
+
+// AddPartitionsResponse - is used as a return value for [AddPartitionsRequest],
+// Warning is set, when keys of new records may be mapped to other partitions.
+type AddPartitionsResponse struct {
+	Partitions int64  `json:"partitions"`
+	Epoch      int64  `json:"epoch"`
+	Warning    string `json:"warning,omitempty"`
+}
+
+// LowWatermarkRequest - is used to request the offset of the first stored record in a partition
+type LowWatermarkRequest struct {
+	Partition int64 `json:"partition"`
+}
+
+// LowWatermarkResponse - is used as a return value for [LowWatermarkRequest]
+type LowWatermarkResponse struct {
+	Offset int64 `json:"offset"`
+}
+
+// CompactPartitionRequest - is used to remove all records of a partition,
+// except the latest one for every key
+type CompactPartitionRequest struct {
+	Partition int64 `json:"partition"`
+}
+
+// CompactPartitionResponse - is used as a return value for [CompactPartitionRequest]
+type CompactPartitionResponse struct {
+	Removed int64 `json:"removed"`
+}
+
+// DeleteExpiredLogsRequest - is used to remove the oldest logs of a partition, which contain only expired records
+type DeleteExpiredLogsRequest struct {
+	Partition int64 `json:"partition"`
+}
+
+// DeleteExpiredLogsResponse - is used as a return value for [DeleteExpiredLogsRequest]
+type DeleteExpiredLogsResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// ResetPolicy chooses the offset of a consumer group, which has not committed an offset yet.
+type ResetPolicy string
+
+const (
+	// ResetToLatest starts at the high watermark, it is used by default.
+	ResetToLatest ResetPolicy = "latest"
+	// ResetToEarliest starts at the first stored record.
+	ResetToEarliest ResetPolicy = "earliest"
+	// ResetByTimestamp starts at the first record with a timestamp at or after the requested one.
+	ResetByTimestamp ResetPolicy = "by_timestamp"
+	// ResetToNone fails, when there is no committed offset.
+	ResetToNone ResetPolicy = "none"
+)
+
+// CommitOffsetRequest - is used to save the position of a consumer group in a partition,
+// Offset is the offset of the next record, which the group will consume.
+// MemberID and Generation are required, when the group has members.
+type CommitOffsetRequest struct {
+	Group      string `json:"group"`
+	MemberID   string `json:"member_id,omitempty"`
+	Generation int64  `json:"generation,omitempty"`
+	Topic      string `json:"topic"`
+	Partition  int64  `json:"partition"`
+	Offset     int64  `json:"offset"`
+	Metadata   string `json:"metadata,omitempty"`
+}
+
+// CommitOffsetResponse - is used as a return value for [CommitOffsetRequest]
+type CommitOffsetResponse struct {
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// FetchOffsetRequest - is used to request the position of a consumer group in a partition,
+// Reset and Timestamp are used, when the group has not committed an offset.
+type FetchOffsetRequest struct {
+	Group     string      `json:"group"`
+	Topic     string      `json:"topic"`
+	Partition int64       `json:"partition"`
+	Reset     ResetPolicy `json:"reset,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// FetchOffsetResponse - is used as a return value for [FetchOffsetRequest],
+// Committed is false, when the Offset is chosen by the reset policy.
+type FetchOffsetResponse struct {
+	Offset    int64  `json:"offset"`
+	Metadata  string `json:"metadata,omitempty"`
+	Committed bool   `json:"committed"`
+}
+
+// DeleteOffsetsRequest - is used to remove committed offsets of a consumer group for a topic
+type DeleteOffsetsRequest struct {
+	Group string `json:"group"`
+	Topic string `json:"topic"`
+}
+
+// TopicPartitions - is a set of partitions of a topic
+type TopicPartitions struct {
+	Topic      string  `json:"topic"`
+	Partitions []int64 `json:"partitions"`
+}
+
+// JoinGroupRequest - is used to join a consumer group or to get the current assignment of a member,
+// a new member leaves MemberID empty. Assignor is a name of the assignment strategy of the group.
+type JoinGroupRequest struct {
+	Group          string        `json:"group"`
+	MemberID       string        `json:"member_id,omitempty"`
+	Topics         []string      `json:"topics"`
+	SessionTimeout time.Duration `json:"session_timeout"`
+	Assignor       string        `json:"assignor,omitempty"`
+}
+
+// JoinGroupResponse - is used as a return value for [JoinGroupRequest],
+// Assignment leaves out partitions, which their previous owners have not released yet.
+type JoinGroupResponse struct {
+	MemberID   string            `json:"member_id"`
+	Generation int64             `json:"generation"`
+	Assignment []TopicPartitions `json:"assignment"`
+}
+
+// HeartbeatRequest - is used to keep a member in a consumer group
+type HeartbeatRequest struct {
+	Group      string `json:"group"`
+	MemberID   string `json:"member_id"`
+	Generation int64  `json:"generation"`
+}
+
+// HeartbeatResponse - is used as a return value for [HeartbeatRequest]
+type HeartbeatResponse struct{}
+
+// LeaveGroupRequest - is used to leave a consumer group
+type LeaveGroupRequest struct {
+	Group    string `json:"group"`
+	MemberID string `json:"member_id"`
+}
+
+// GroupLagRequest - is used to request the lag of a consumer group in partitions, it has committed offsets for
+type GroupLagRequest struct {
+	Group string `json:"group"`
+}
+
+// PartitionLag - is the lag of a consumer group in a partition,
+// TimeLag is the difference between timestamps of the newest record and the first record, which is not consumed,
+// both are taken from the timestamp index.
+type PartitionLag struct {
+	Topic         string        `json:"topic"`
+	Partition     int64         `json:"partition"`
+	Committed     int64         `json:"committed"`
+	HighWatermark int64         `json:"high_watermark"`
+	Lag           int64         `json:"lag"`
+	TimeLag       time.Duration `json:"time_lag"`
+}
+
+// GroupLagResponse - is used as a return value for [GroupLagRequest],
+// Partitions are ordered by topic and partition.
+type GroupLagResponse struct {
+	Group      string         `json:"group"`
+	Partitions []PartitionLag `json:"partitions"`
+}
+
+// ReceiveRequest - is used to receive up to Max records from a partition of a topic in the queue mode,
+// every record is hidden from other consumers for the VisibilityTimeout, until it is acknowledged.
+// MaxWait is the time to wait for records, when none is available.
+type ReceiveRequest struct {
+	Topic             string        `json:"topic"`
+	Partition         int64         `json:"partition"`
+	Consumer          string        `json:"consumer,omitempty"`
+	Max               int64         `json:"max"`
+	VisibilityTimeout time.Duration `json:"visibility_timeout,omitempty"`
+	MaxWait           time.Duration `json:"max_wait,omitempty"`
+}
+
+// QueueMessage - is a record, which is delivered in the queue mode,
+// Delivery is the number of the delivery, it is required to acknowledge the record.
+type QueueMessage struct {
+	ReadFromPartitionResponse
+	Delivery int64     `json:"delivery"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// ReceiveResponse - is used as a return value for [ReceiveRequest]
+type ReceiveResponse struct {
+	Messages []QueueMessage `json:"messages"`
+}
+
+// AckRequest - is used to complete a delivered record
+type AckRequest struct {
+	Topic     string `json:"topic"`
+	Partition int64  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Delivery  int64  `json:"delivery"`
+}
+
+// NackRequest - is used to return a delivered record into the queue,
+// it is delivered again after the Delay.
+type NackRequest struct {
+	Topic     string        `json:"topic"`
+	Partition int64         `json:"partition"`
+	Offset    int64         `json:"offset"`
+	Delivery  int64         `json:"delivery"`
+	Delay     time.Duration `json:"delay,omitempty"`
+}
+
+// RejectRequest - is used to move a delivered record into the next retry topic or the dead letter topic
+type RejectRequest struct {
+	Topic     string `json:"topic"`
+	Partition int64  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Delivery  int64  `json:"delivery"`
+	Reason    string `json:"reason"`
+}
+
+// RejectRecordRequest - is used by a member of a consumer group to move a record,
+// which it has failed to process Attempts times, into the next retry topic or the dead letter topic
+type RejectRecordRequest struct {
+	Group      string `json:"group"`
+	MemberID   string `json:"member_id,omitempty"`
+	Generation int64  `json:"generation,omitempty"`
+	Topic      string `json:"topic"`
+	Partition  int64  `json:"partition"`
+	Offset     int64  `json:"offset"`
+	Reason     string `json:"reason"`
+	Attempts   int64  `json:"attempts"`
+}
+
+// RejectRecordResponse - is used as a return value for [RejectRecordRequest]
+type RejectRecordResponse struct {
+	Destination string `json:"destination"`
+}
+
+// ScheduleRequest - is used to write a record into a topic at the DeliverAt time,
+// the partition is chosen by the topic's partitioner at that time, unless Partition is set.
+type ScheduleRequest struct {
+	Topic     string          `json:"topic"`
+	Partition *int64          `json:"partition,omitempty"`
+	Key       []byte          `json:"key,omitempty"`
+	Value     []byte          `json:"value"`
+	Headers   []record.Header `json:"headers,omitempty"`
+	DeliverAt time.Time       `json:"deliver_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// ScheduleResponse - is used as a return value for [ScheduleRequest]
+type ScheduleResponse struct {
+	ID        string    `json:"id"`
+	DeliverAt time.Time `json:"deliver_at"`
+}
+
+// CancelScheduleRequest - is used to cancel a scheduled record, which is not delivered yet
+type CancelScheduleRequest struct {
+	ID string `json:"id"`
 }
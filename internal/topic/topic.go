@@ -1,6 +1,7 @@
 package topic
 
+// Topic is a named set of partitions.
 type Topic struct {
-	Name      string `json:"name"`
-	Partition int64  `json:"partition"`
+	Name       string `json:"name"`
+	Partitions int64  `json:"partitions"`
 }